@@ -0,0 +1,3 @@
+module jsonizer
+
+go 1.22
@@ -1,475 +1,392 @@
 package main
-import ("fmt"; "log"; "strings"; "io/ioutil"; "time"; "regexp"; "os"; "strconv")
+import ("fmt"; "log"; "strings"; "io"; "io/ioutil"; "bufio"; "time"; "os"; "strconv"; "flag"; "errors"; "encoding/json"; "runtime"; "path/filepath"; "jsonizer/types"; "jsonizer/rules")
+
+/**
+	User defined (command line flags).
+
+	@anywhere rules may start at any word of the line, not only at the first one
+	@tokenizer how lines are split into words (see 'tokenizers')
+	@format built-in preset for a common log format used instead of patterns.txt (see 'presets')
+	@json write output as one JSON object per line
+	@policy which of more matches found on one line is output: first, longest or all
+	@follow keep reading the file as it grows (also after it is rotated)
+	@o write output to this file instead of stdout
+	@workers number of goroutines processing lines
+	@batch number of lines one goroutine processes at once
+	@explain write for every line how each match was compared with it and why it failed
+	@layout, @year how timestamp tokens are read (defined by package types, see types.DefineFlags)
+*/
+var anywhere = flag.Bool("anywhere", false, "rules may start at any word of the line, not only at the first one")
+var tokenizerName = flag.String("tokenizer", "space", "how lines are split into words: space, whitespace, quote, bracket, csv, tsv or kv")
+var format = flag.String("format", "", "preset instead of patterns.txt: clf, combined (apache, nginx), syslog (rfc3164), rfc5424 or logfmt")
+var jsonOutput = flag.Bool("json", false, "write output as one JSON object per line")
+var policy = flag.String("policy", "longest", "which of more matches found on one line is output: first, longest or all")
+var follow = flag.Bool("follow", false, "keep reading the file as it grows, also after it is rotated")
+var outputPath = flag.String("o", "", "write output to this file instead of stdout")
+var workers = flag.Int("workers", runtime.NumCPU(), "number of goroutines processing lines")
+var batchSize = flag.Int("batch", 256, "number of lines one goroutine processes at once")
+var explainFlag = flag.Bool("explain", false, "write for every line how each match was compared with it and why it failed")
+
+func init() {
+	types.DefineFlags(flag.CommandLine) //-layout and -year of timestamp tokens
+}
 
 func main() {
 	startTime := time.Now()
-	//Reads Input files
-	pFile, err := ioutil.ReadFile("patterns.txt")
-	if err != nil {
-		log.Fatal(err)
-	}
-	tFile, err := ioutil.ReadFile("text.txt")
-	if err != nil {
-		log.Fatal(err)
-	}
-	tokFile, err := ioutil.ReadFile("tokens.txt")
+	flag.Parse()
+	set, err := loadRules(".")
 	if err != nil {
 		log.Fatal(err)
 	}
-	tokenFile, patternsFile, textFile := string(tokFile),string(pFile),string(tFile)
-	//Preprocessing
-	pOnMatchLine := make(map[int][]string)
-	matches := make(map[int][]string)
-	lines := strings.Split(patternsFile, "\r\n")
-	for i := range lines {
-		line := strings.Split(lines[i], " ")
-		pOnMatchLine[i] = make([]string, 0)
-		for j := range line {
-			if line[j][0] == '{' {
-				pOnMatchLine[i] = addWord(pOnMatchLine[i], getWord(1, len(line[j])-2, line[j]))
-			}
-		}
-		matches[i] = strings.Split(lines[i], " ")
-	}
+	matches, priorities := set.Matches, set.Priorities
 	//Print some stuff out
-	fmt.Printf("\nJSONIZER\n-----------------------\nPatterns.txt\n")
-	for i,arrayOfS := range matches {
-		fmt.Printf("Match %d: ", i+1)
-		for j := range arrayOfS {
-			fmt.Printf("%q ", arrayOfS[j])
+	fmt.Fprintf(os.Stderr, "\nJSONIZER\n-----------------------\nPatterns.txt\n")
+	for i := range matches {
+		fmt.Fprintf(os.Stderr, "Match %d: ", i+1)
+		if priorities[i] != 0 {
+			fmt.Fprintf(os.Stderr, "@%d ", priorities[i])
+		}
+		for j := range matches[i] {
+			fmt.Fprintf(os.Stderr, "%q ", matches[i][j].String())
 		}
-		fmt.Println()
+		fmt.Fprintln(os.Stderr)
 	}
-	//searching for matches
-	outputPerLine := make(map[int]map[int][]string)
-	wordOccurences := make(map[string][]int)
-	lines = strings.Split(textFile, "\r\n")
-	for n := range lines { 
-		outputPerLine[n] = make(map[int][]string) //initialize
-		currentLine := strings.Split(lines[n], " ")
-		for m := range matches {
-			if len(pOnMatchLine[m]) > 0 { //if there are words in this match, search for them
-				wordOccurences = searchSBOM(pOnMatchLine[m], lines[n])
-			}
-			for wordPos, mW := 0, 0; mW < len(matches[m]) && mW < len(currentLine); mW++ {
-				if matches[m][mW][0] == '<' { //REGEX_MATCHING
-					tokenToMatch := getWord(1, len(matches[m][mW])-2, matches[m][mW])
-					regex := regexp.MustCompile(getToken(tokenFile, tokenToMatch))
-					if  !regex.MatchString(currentLine[mW]) { //NO_MATCH
-						outputPerLine[n][m] = make([]string, 0) //current line current match set to empty
-						break
-					} else { //store match number: token + value
-						currentStrings := outputPerLine[n][m]
-						currentStrings = addWord(currentStrings, tokenToMatch+" = "+currentLine[mW])
-						outputPerLine[n][m] = currentStrings 
-					}
-				} else if matches[m][mW][0] == '{' { //WORD_MATCHING
-					wordToMatch := getWord(1, len(matches[m][mW])-2, matches[m][mW])
-					if !contains(wordOccurences[wordToMatch],wordPos) { //NO_MATCH
-						outputPerLine[n][m] = make([]string, 0) //if len == 0 printFile nothing
-						break
-					} else if mW == len(matches[m])-1{
-						//store match number & nothing else
-						if len(outputPerLine[n][m]) < 1 {
-							currentStrings := outputPerLine[n][m]
-							currentStrings = addWord(currentStrings, "") //if len == 1 && [0]=="" printFile MATCH + [number]
-							outputPerLine[n][m] = currentStrings 
-						}
-					}
-				} else {
-					log.Fatal("Unknown expression in Match "+strconv.Itoa(m+1)+": '"+getWord(0, len(matches[m][mW])-1, matches[m][mW])+ "'")
-				}
-				wordPos = wordPos + len(currentLine[mW]) +1
-			}
+	//opening input (file or stdin) and output (stdout or -o file)
+	var input io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "" && path != "-" {
+		var file io.ReadCloser
+		if *follow {
+			file, err = newFollower(path)
+		} else {
+			file, err = os.Open(path)
+		}
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer file.Close()
+		input = file
+	} else if *follow {
+		log.Fatal("-follow needs a file to read")
 	}
-	//writing output to a file output.txt
-	path := "output.txt"
-	file, err := os.Create(path)
-	if err != nil {
+	if err := types.SetReference(flag.Arg(0), *follow); err != nil {
 		log.Fatal(err)
 	}
-	defer file.Close()
-	for n := range lines { //for each line
-		isEmpty := true
-		out, newOut := "", ""
-		for matchNumber := range outputPerLine[n] {
-			strs := outputPerLine[n][matchNumber]
-			if len(strs) == 1 && strs[0] == "" { //one match with no tokens to print
-				isEmpty = false
-				if len(out) == 0 { //no ouptut match yet
-					out = strconv.Itoa(matchNumber+1)
-				} else { //old and current match are of the same length
-					oldMatchNumber, err := strconv.Atoi(out) //number of previous match found
-					if err == nil && len(matches[matchNumber]) > len(matches[oldMatchNumber-1]) {
-						out = strconv.Itoa(matchNumber+1)
-					}
-				}
-			} else if len(strs) >= 1 { //match with tokens to print
-				isEmpty = false
-				if len(strs) > 1 {
-					newOut = strconv.Itoa(matchNumber+1) +", {"
-					for s := range strs {
-						if s == len(strs)-1 {
-							newOut = newOut+strs[s]+"}"
-						} else {
-							newOut = newOut+strs[s]+", "
-						}
-					}
-				} else{
-					newOut = strconv.Itoa(matchNumber+1) +", {"+strs[0]+"}"
-				}
-				oldString := strings.Split(out, ",") //we will read first int from out - match number
-				if len(oldString) == 1 && oldString[0] != "" {
-					oldMatchNumber, err := strconv.Atoi(out)
-					if err == nil && len(matches[matchNumber]) > len(matches[oldMatchNumber-1]) {
-						out = newOut
-					}
-				} else if len(oldString) == 1 && oldString[0] == ""{ //there was no old match
-					out = newOut
-				}
-			}
-		}
-		if isEmpty {
-			_, err := file.WriteString("NO_MATCH\r\n")
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			_, err := file.WriteString("MATCH + ["+out+"]\r\n")
-			if err != nil {
-				log.Fatal(err)
-			}
+	var output io.Writer = os.Stdout
+	if *outputPath != "" {
+		file, err := os.Create(*outputPath)
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer file.Close()
+		output = file
+	}
+	//searching for matches in batches of lines on more goroutines, results are written in order right away
+	if *workers < 1 || *batchSize < 1 {
+		log.Fatal("-workers and -batch have to be at least 1")
+	}
+	if err := processAll(bufio.NewReader(input), output, set, *workers, *batchSize); err != nil {
+		log.Fatal(err)
 	}
 	elapsed := time.Since(startTime)
-	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
+	fmt.Fprintf(os.Stderr, "\n\nElapsed %f secs\n", elapsed.Seconds())
 	return
 }
 
-/*******************            SBOM functions          *******************/
+/*******************            Line functions          *******************/
 
-func searchSBOM(p []string, t string) map[string][]int {
-	lmin := computeMinLength(p)
-	or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
-	occurences := make(map[string][]int)
-	pos := 0
-	for pos <= len(t) - lmin {
-			current := 0
-			j := lmin
-			for j >= 1 && stateExists(current, or) {
-					current = getTransition(current, t[pos+j-1], or)
-					j--
-			}
-			word := getWord(pos, pos+lmin-1, t)
-			if stateExists(current, or) && j == 0 && strings.HasPrefix(word, getCommonPrefix(p, f[current], lmin)) {
-					for i := range f[current] {
-							if p[f[current][i]] == getWord(pos, pos-1+len(p[f[current][i]]), t) {
-									occurences[p[f[current][i]]] = intArrayCapUp(occurences[p[f[current][i]]])
-									occurences[p[f[current][i]]][len(occurences[p[f[current][i]]])-1] = pos
-							}
-					}
-					j = 0
+/**
+	Reads tokens.txt and patterns.txt (or a preset chosen by -format) from directory 'dir'
+	and returns rule set with the options given by flags.
+*/
+func loadRules(dir string) (*rules.Set, error) {
+	if *policy != "first" && *policy != "longest" && *policy != "all" {
+		return nil, errors.New("Unknown policy: "+*policy)
+	}
+	tokenize, ok := rules.Tokenizers[*tokenizerName]
+	if !ok {
+		return nil, errors.New("Unknown tokenizer: "+*tokenizerName)
+	}
+	//Reads Input files
+	tokFile, err := ioutil.ReadFile(filepath.Join(dir, "tokens.txt"))
+	if err != nil && (*format == "" || !os.IsNotExist(err)) { //tokens.txt is optional for presets
+		return nil, err
+	}
+	tokens, _, err := types.Parse(string(tokFile))
+	if err != nil {
+		return nil, err
+	}
+	var matches [][]rules.Element
+	var priorities []int
+	if *format == "" {
+		pFile, err := ioutil.ReadFile(filepath.Join(dir, "patterns.txt"))
+		if err != nil {
+			return nil, err
+		}
+		matches, priorities, err = rules.ParseMatches(string(pFile))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p, ok := rules.Presets[*format]
+		if !ok {
+			return nil, errors.New("Unknown format: "+*format)
+		}
+		tokenize = p.Tokenize
+		presetTokens, _, err := types.Parse(p.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		for name, t := range presetTokens {
+			if _, ok := tokens[name]; !ok { //tokens.txt overrides preset definitions
+				tokens[name] = t
 			}
-			pos = pos + j + 1
+		}
+		matches, priorities, _ = rules.ParseMatches("<*>") //every word under its key
+	}
+	//Preprocessing
+	set, err := rules.New(matches, priorities, tokens, tokenize)
+	if err != nil {
+		return nil, err
 	}
-	return occurences
+	set.Anywhere, set.Policy, set.ExplainLines = *anywhere, *policy, *explainFlag
+	return set, nil
 }
 
-/**
-        Function that builds factor oracle used by sbom.
-*/
-func buildOracleMultiple (p []string) (orToReturn map[int]map[uint8]int, f map[int][]int) {
-        orTrie, stateIsTerminal, f := constructTrie(p)
-        s := make([]int, len(stateIsTerminal)) //supply function
-        i := 0 //root of trie
-        orToReturn = orTrie
-        s[i] = -1
-        for current := 1; current < len(stateIsTerminal); current++ {
-                o, parent := getParent(current, orTrie)
-                down := s[parent]
-                for stateExists(down, orToReturn) && getTransition(down, o, orToReturn) == -1 {
-                        createTransition(down, o, current, orToReturn)
-                        down = s[down]
-                }
-                if stateExists(down, orToReturn) {
-                        s[current] = getTransition(down, o, orToReturn)
-                } else {
-                        s[current] = i
-                }
-        }
-        return orToReturn, f
-}
+/*******************          Parallel functions          *******************/
 
 /**
-        Function that constructs Trie as an automaton for a set of reversed & trimmed strings.
-        
-        @return 'trie' built prefix tree
-        @return 'stateIsTerminal' array of all states and boolean values of their terminality
-        @return 'f' map with keys of pattern indexes and values - arrays of p[i] terminal states
+	Lines processed by one goroutine. 'done' is closed when 'results' are ready.
 */
-func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []bool, f map[int][]int) {
-        trie = make(map[int]map[uint8]int)
-        stateIsTerminal = make([]bool, 1)
-        f = make(map[int][]int) 
-        state := 1
-        createNewState(0, trie)
-        for i:=0; i<len(p); i++ {
-                current := 0
-                j := 0
-                for j < len(p[i]) && getTransition(current, p[i][j], trie) != -1 {
-                        current = getTransition(current, p[i][j], trie)
-                        j++
-                }
-                for j < len(p[i]) {
-                        stateIsTerminal = boolArrayCapUp(stateIsTerminal)
-                        createNewState(state, trie)
-                        stateIsTerminal[state] = false
-                        createTransition(current, p[i][j], state, trie)
-                        current = state
-                        j++
-                        state++
-                }
-                if stateIsTerminal[current] {
-                        newArray := intArrayCapUp(f[current])
-                        newArray[len(newArray)-1] = i
-                        f[current] = newArray
-                } else {
-                        stateIsTerminal[current] = true
-                        f[current] = []int {i}
-                }
-        }
-        return trie, stateIsTerminal, f
+type batch struct {
+	first int
+	lines []string
+	results []rules.Result
+	done chan struct{}
 }
 
-/*******************          String functions          *******************/
 /**
-	Returns regex for desired token in string 'tokenFile'.
+	Reads lines from 'reader', processes them in batches of 'batchSize' lines by 'workers' goroutines
+	and writes results to 'output' in the order of the lines. At most 2*'workers' batches are
+	in progress at once, reading waits for the output otherwise (backpressure).
+	A batch is sent off earlier when no more input is ready, so results of a slow input
+	(stdin, -follow) are written as soon as the lines come.
 */
-func getToken(tokenFile, wanted string) string {
-	tokenLines := strings.Split(tokenFile, "\r\n")
-	for n := range tokenLines {
-		token := strings.Split(tokenLines[n], " ")
-		if token[0] == wanted {
-			return token[1]
+func processAll(reader *bufio.Reader, output io.Writer, set *rules.Set, workers, batchSize int) error {
+	jobs := make(chan *batch, workers)
+	ordered := make(chan *batch, 2*workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for b := range jobs {
+				b.results = make([]rules.Result, len(b.lines))
+				for i := range b.lines {
+					b.results[i] = set.Process(b.first+i, b.lines[i])
+				}
+				close(b.done)
+			}
+		}()
+	}
+	var readErr error
+	go func() { //reading
+		defer close(ordered)
+		defer close(jobs)
+		b := &batch{done: make(chan struct{})}
+		for n := 0; ; n++ {
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				readErr = err
+				return
+			}
+			if line != "" {
+				b.lines = append(b.lines, strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+			}
+			if len(b.lines) > 0 && (len(b.lines) == batchSize || reader.Buffered() == 0 || err == io.EOF) {
+				ordered <- b //waits when too many batches are in progress
+				jobs <- b
+				b = &batch{first: n+1, done: make(chan struct{})}
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+	writer := bufio.NewWriter(output)
+	for b := range ordered { //writing in order
+		<-b.done
+		for _, r := range b.results {
+			if err := writeResult(writer, r); err != nil {
+				return err
+			}
+		}
+		if len(ordered) == 0 { //next batch is not ready yet
+			if err := writer.Flush(); err != nil {
+				return err
+			}
 		}
 	}
-	log.Fatal("NO TOKEN DEFINITION in tokens.txt FOR: ", wanted)
-	return ""
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return readErr
 }
 
-/**
-        Returns a prefix size 'lmin' for one string 'p' of first index found in 'f'.
-        It is not needed to compare all the strings from 'p' indexed in 'f',
-        thanks to the konwledge of 'lmin'.
-*/
-func getCommonPrefix(p []string, f []int, lmin int) string {
-        r := []rune(p[f[0]])
-        newR := make([]rune, lmin)
-        for j := 0; j < lmin; j++ {
-                newR[j] = r[j]
-        }
-        return string(newR)
-}
+/*******************            Follow functions          *******************/
 
 /**
-        Function that takes a set of strings 'p' and their wanted 'length'
-        and then trims each string in that set to have desired 'length'.
-*/
-func trimToLength(p []string, length int) (trimmedP []string) {
-        trimmedP = make([]string, len(p))
-        for i := range p {
-                r := []rune(p[i])
-                newR := make([]rune, length)
-                for j := 0; j < length; j++ {
-                        newR[j] = r[j]
-                }
-                trimmedP[i]=string(newR)
-        }
-        return trimmedP
-}
-
-/**        
-        Function that takes an array of strings and reverses it.
+	Reader of a growing file (-follow). At the end of the file it waits for more data
+	instead of returning io.EOF. When the file is rotated (path points to another file)
+	the rest of the old one is read and the new one is opened, a truncated file is read from the start.
 */
-func reverseAll(s []string) (reversed []string) {
-        reversed = make([]string, len(s))
-        for i := 0; i < len(s); i++ {
-                reversed[i] = reverse(s[i])
-        }
-        return reversed
+type follower struct {
+	path string
+	file *os.File
+	poll time.Duration
 }
 
-/**        
-        Function that takes a single string and reverses it.
-        @author 'Walter' http://stackoverflow.com/a/10043083
-*/
-func reverse(s string) string {
-    l := len(s)
-    m := make([]rune, l)
-    for _, c := range s {
-        l--
-        m[l] = c
-    }
-    return string(m)
+func newFollower(path string) (*follower, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &follower{path: path, file: file, poll: 250*time.Millisecond}, nil
 }
 
-/**
-	Check's if word 'w 'exist in array of strings 's', if not - add's it.
-	Returns 's' containing word 'w'.
-*/
-func addWord(s []string, w string) (output []string) {
-	for i := range s {
-		if s[i] == w {
-			return s
+func (f *follower) Read(b []byte) (int, error) {
+	for {
+		n, err := f.file.Read(b)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if !f.reopen() {
+			time.Sleep(f.poll)
 		}
 	}
-	s = stringArrayCapUp(s)
-	s[len(s)-1] = w
-	return s
 }
 
 /**
-	Function that returns word found in text 't' at position range 'begin' to 'end'.
+	Checks if the followed file was rotated or truncated, returns 'true' if reading should start again.
 */
-func getWord(begin, end int, t string) string {
-	for end >= len(t) {
-		return ""
+func (f *follower) reopen() bool {
+	info, err := os.Stat(f.path)
+	if err != nil { //moved away, new file is not there yet
+		return false
 	}
-	d := make([]uint8, end-begin+1)
-	for j, i := 0, begin; i <= end; i, j = i+1, j+1 {
-		d[j] = t[i]
+	current, err := f.file.Stat()
+	if err != nil {
+		return false
 	}
-	return string(d)
-}
-
-/**
-        Function that computes minimal length string in a set of strings.
-*/
-func computeMinLength(p []string) (lmin int){
-        lmin = len(p[0])
-        for i:=1; i<len(p); i++ {
-                if (len(p[i])<lmin) {
-                        lmin = len(p[i])
-                }
-        }
-        return lmin
-}
-
-/*******************            Array functions            *******************/
-/**
-	Functions 'type'ArrayCapUp dynamically increases an 'type's array 
-	maximum size by 1. (copy(dst,src))
-*/
-func byteArrayCapUp (old []byte)(new []byte) {
-	new = make([]byte, cap(old)+1)
-	copy(new, old)  
-	return new
-}
-
-func intArrayCapUp (old []int)(new []int) {
-	new = make([]int, cap(old)+1)
-	copy(new, old) 
-	return new
+	if !os.SameFile(info, current) {
+		if n, _ := f.file.Seek(0, io.SeekCurrent); n < current.Size() { //old file got more data meanwhile
+			return true
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return false
+		}
+		f.file.Close()
+		f.file = file
+		return true
+	}
+	if pos, err := f.file.Seek(0, io.SeekCurrent); err == nil && info.Size() < pos { //truncated
+		_, err = f.file.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return false
 }
 
-
-func boolArrayCapUp (old []bool)(new []bool) {
-	new = make([]bool, cap(old)+1)
-	copy(new, old)
-	return new
+func (f *follower) Close() error {
+	return f.file.Close()
 }
 
-func stringArrayCapUp (old []string)(new []string) {
-	new = make([]string, cap(old)+1)
-	copy(new, old)  //copy(dst,src)
-	return new
-}
+/*******************            Output functions          *******************/
 
 /**
-	Concats two arrays of int's into one.
+	Writes result for one line in the format chosen by -json.
 */
-func arrayUnion (to, from []int) (concat []int) {
-	concat = to
-	for i := range(from) {
-		if (!contains(concat, from[i])) {
-			concat = intArrayCapUp(concat)
-			concat[len(concat)-1] = from[i]
-		}
+func writeResult(file io.Writer, r rules.Result) error {
+	if _, err := io.WriteString(file, r.Explained); err != nil {
+		return err
 	}
-	return concat
-}
-
-/**
-	Returns 'true' if array of int's 's' contains int 'e', 'false' otherwise.
-	
-	@author Mostafa http://stackoverflow.com/a/10485970
-*/
-func contains(s []int, e int) bool {
-    for _, a := range s {
-		if a == e {
-			return true
-		}
+	if *jsonOutput {
+		return writeJSON(file, r)
 	}
-    return false
+	return writeText(file, r)
 }
 
-/*******************          Automaton functions          *******************/
 /**
-	Function that finds the first previous state of a state and returns it. 
-	Used for trie where there is only one parent.
-	@param 'at' automaton
+	Writes result for one line as "MATCH + [number, {TOKEN = value, ...}]" or "NO_MATCH",
+	followed by " + ERRORS [...]" if some value did not convert to its type.
+	More matches (-policy all) are written as "MATCH + [...] + [...]".
 */
-func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
-	for beginState, transitions := range at {
-		for c, endState := range transitions {
-			if endState == state {
-				return c, beginState
+func writeText(file io.Writer, r rules.Result) error {
+	out := "NO_MATCH"
+	if len(r.Matches) > 0 {
+		out = "MATCH"
+	}
+	for k, match := range r.Matches {
+		m := strconv.Itoa(match+1)
+		if len(r.Captured[k]) > 0 {
+			m = m+", {"
+			for i, c := range r.Captured[k] {
+				if i > 0 {
+					m = m+", "
+				}
+				if c.Typed != nil {
+					m = m+c.Token+" = "+fmt.Sprint(c.Typed)
+				} else {
+					m = m+c.Token+" = "+c.Value
+				}
 			}
+			m = m+"}"
 		}
+		out = out+" + ["+m+"]"
+	}
+	if len(r.Errs) > 0 {
+		out = out+" + ERRORS ["+strings.Join(r.Errs, ", ")+"]"
 	}
-	return 0, 0 //unreachable
+	_, err := io.WriteString(file, out+"\r\n")
+	return err
 }
 
 /**
-	Automaton function for creating a new state 'state'.
-	@param 'at' automaton
+	One line of -json output. 'Matches' is empty for NO_MATCH. Typed values are JSON numbers
+	(int, float) or strings (ip, timestamp in RFC3339).
 */
-func createNewState(state int, at map[int]map[uint8]int) {
-	at[state] = make(map[uint8]int)
+type jsonLine struct {
+	Line int `json:"line"`
+	Matches []jsonMatch `json:"matches"`
+	Errors []string `json:"errors,omitempty"`
 }
 
-/**
- 	Creates a transition for function σ(state,letter) = end.
-	@param 'at' automaton
-*/
-func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
-	at[fromState][overChar]= toState
+type jsonMatch struct {
+	Match int `json:"match"`
+	Tokens []jsonToken `json:"tokens"`
 }
 
-/**
-	Returns ending state for transition σ(fromState,overChar), '-1' if there is none.
-	@param 'at' automaton
-*/
-func getTransition(fromState int, overChar uint8, at map[int]map[uint8]int)(toState int) {
-	if (!stateExists(fromState, at)) {
-		return -1
-	}
-	toState, ok := at[fromState][overChar]
-	if (ok == false) {
-		return -1	
-	}
-	return toState
+type jsonToken struct {
+	Name string `json:"name"`
+	Value interface{} `json:"value"`
 }
 
 /**
-	Checks if state 'state' exists. Returns 'true' if it does, 'false' otherwise.
-	@param 'at' automaton
+	Writes result for one line as one JSON object on a single line.
 */
-func stateExists(state int, at map[int]map[uint8]int)bool {
-	_, ok := at[state]
-	if (!ok || state == -1 || at[state] == nil) {
-		return false
+func writeJSON(file io.Writer, r rules.Result) error {
+	out := jsonLine{Line: r.Line+1, Matches: make([]jsonMatch, 0), Errors: r.Errs}
+	for k, match := range r.Matches {
+		m := jsonMatch{Match: match+1, Tokens: make([]jsonToken, len(r.Captured[k]))}
+		for i, c := range r.Captured[k] {
+			m.Tokens[i] = jsonToken{Name: c.Token, Value: c.Value}
+			if c.Typed != nil {
+				m.Tokens[i].Value = c.Typed
+			}
+		}
+		out.Matches = append(out.Matches, m)
 	}
-	return true
-}
\ No newline at end of file
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(out) //ends with a newline
+}
+
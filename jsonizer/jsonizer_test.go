@@ -0,0 +1,158 @@
+package main
+
+import ("testing"; "flag"; "bufio"; "bytes"; "os"; "io/ioutil"; "path/filepath"; "strings"; "jsonizer/types"; "jsonizer/rules")
+
+var update = flag.Bool("update", false, "write output of jsonizer to output.txt instead of comparing it")
+
+/**
+	Golden-file tests. Every case is a directory with tokens.txt, patterns.txt, text.txt
+	and output.txt, the expected output. Optional flags.txt holds command line flags of jsonizer
+	(cases with -format need no patterns.txt).
+	Case "." is the example shipped in this directory, the others are in testdata.
+*/
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*", "text.txt")) //not testdata/fuzz
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range append([]string{"text.txt"}, fixtures...) {
+		dir := filepath.Dir(fixture)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			got := runGolden(t, dir)
+			expectedPath := filepath.Join(dir, "output.txt")
+			if *update {
+				if err := ioutil.WriteFile(expectedPath, []byte(got+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := ioutil.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareLines(t, got, normalize(string(expected)))
+		})
+	}
+}
+
+/**
+	Runs jsonizer on directory 'dir' with flags from flags.txt and returns its output.
+*/
+func runGolden(t *testing.T, dir string) string {
+	names, err := setFlags(filepath.Join(dir, "flags.txt"))
+	defer resetFlags(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := loadRules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := types.SetReference(filepath.Join(dir, "text.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	input, err := os.Open(filepath.Join(dir, "text.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	var output bytes.Buffer
+	//Small batches, so that the lines are split among more workers
+	if err := processAll(bufio.NewReader(input), &output, set, 4, 3); err != nil {
+		t.Fatal(err)
+	}
+	return normalize(output.String())
+}
+
+/**
+	Sets flags written in file 'path' (separated by white space, e.g. "-tokenizer=csv -json").
+	Missing file means no flags. Returns names of the flags, which were set.
+*/
+func setFlags(path string) (names []string, err error) {
+	options, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, option := range strings.Fields(string(options)) {
+		name := strings.TrimLeft(option, "-")
+		value := "true"
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		if err := flag.Set(name, value); err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+/**
+	Sets flags 'names' back to their default values.
+*/
+func resetFlags(names []string) {
+	for _, name := range names {
+		f := flag.Lookup(name)
+		f.Value.Set(f.DefValue)
+	}
+}
+
+/**
+	Unifies line endings and trailing new line, so that output.txt may be edited on any system.
+*/
+func normalize(s string) string {
+	return strings.TrimRight(strings.Replace(s, "\r\n", "\n", -1), "\n")
+}
+
+/**
+	Reports first line, where 'got' differs from 'expected'.
+*/
+func compareLines(t *testing.T, got, expected string) {
+	gotLines, expectedLines := strings.Split(got, "\n"), strings.Split(expected, "\n")
+	for i := 0; i < len(gotLines) || i < len(expectedLines); i++ {
+		var g, e string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if g != e {
+			t.Fatalf("output differs at line %d (run with -update to accept it):\n got: %q\nwant: %q", i+1, g, e)
+		}
+	}
+}
+
+/**
+	Run with: go test -fuzz FuzzParseTokens jsonizer.go jsonizer_test.go
+	Every parsed token has a known type and a regex, unless it is checked by its type only.
+*/
+func FuzzParseTokens(f *testing.F) {
+	tokFile, err := ioutil.ReadFile("tokens.txt")
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(string(tokFile))
+	f.Add(rules.Presets["clf"].Tokens)
+	f.Add(rules.Presets["syslog"].Tokens)
+	f.Fuzz(func(t *testing.T, tokFile string) {
+		tokens, names, err := types.Parse(tokFile)
+		if err != nil {
+			return
+		}
+		if len(names) != len(tokens) {
+			t.Errorf("%q: %d tokens, named %q", tokFile, len(tokens), names)
+		}
+		for name, token := range tokens {
+			if _, ok := types.Converters[token.Kind]; token.Kind != "" && !ok {
+				t.Errorf("%q: token %s has unknown type %q", tokFile, name, token.Kind)
+			}
+			if (token.Regex == nil) != token.Strict || (token.Strict && token.Kind == "") {
+				t.Errorf("%q: token %s has neither a regex nor a type", tokFile, name)
+			}
+			token.Match(name)
+		}
+	})
+}
@@ -1,14 +1,135 @@
 ﻿package main
-import ("regexp"; "fmt";"io/ioutil"; "strings")
+import ("regexp"; "fmt"; "io/ioutil"; "strings"; "flag"; "log"; "os"; "errors"; "strconv"; "jsonizer/types")
 
+/**
+	User defined (command line flags).
+
+	@tokens token definitions to test
+	@tests positive and negative examples of the tokens
+	@single only test one regex against one word from testedRegex.txt
+	@layout, @year how timestamp tokens are read, as by jsonizer (see types.DefineFlags)
+*/
+var tokensPath = flag.String("tokens", "../tokens.txt", "token definitions to test")
+var testsPath = flag.String("tests", "testedTokens.txt", "positive and negative examples of the tokens")
+var single = flag.Bool("single", false, "only test one regex against one word from testedRegex.txt")
+
+func init() {
+	types.DefineFlags(flag.CommandLine)
+}
+
+/**
+	Test runner for tokens.txt of jsonizer, read by the same functions as jsonizer reads it (package types).
+	Each token gets positive ('+') and negative ('-') examples in testedTokens.txt,
+	prints PASS or FAIL for each token and exits with 1 if some token failed.
+*/
 func main() {
 	/*The syntax of the regular expressions accepted is the same general syntax used by Perl,
 	PYTHON!, and other languages. More precisely, it is the syntax accepted by RE2 and described
 	at http://code.google.com/p/re2/wiki/Syntax, except for \C.*/
-	patFile,_ := ioutil.ReadFile("testedRegex.txt")
-	patText := strings.Split(string(patFile), " ")
-	matched,err := regexp.MatchString(patText[0], patText[1])
-	fmt.Printf("\n%t\n\n\nErrors: ", matched)
-	fmt.Println(err)
+	flag.Parse()
+	if *single {
+		patFile,_ := ioutil.ReadFile("testedRegex.txt")
+		patText := string(patFile)
+		lastSpace := strings.LastIndex(patText, " ") //regex may contain spaces, the word may not
+		if lastSpace < 0 {
+			log.Fatal("testedRegex.txt needs a regex and a word separated by a space")
+		}
+		matched,err := regexp.MatchString(patText[:lastSpace], strings.TrimRight(patText[lastSpace+1:], "\r\n"))
+		fmt.Printf("\n%t\n\n\nErrors: ", matched)
+		fmt.Println(err)
+		return
+	}
+	tokFile, err := ioutil.ReadFile(*tokensPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	testFile, err := ioutil.ReadFile(*testsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens, names, err := types.Parse(string(tokFile))
+	if err != nil {
+		log.Fatal(err)
+	}
+	examples, err := parseExamples(string(testFile), tokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := 0
+	for _, name := range names {
+		if len(examples[name]) == 0 {
+			fmt.Printf("NO TESTS %s\n", name)
+			continue
+		}
+		failures := runExamples(tokens[name], examples[name])
+		if len(failures) > 0 {
+			failed++
+			fmt.Printf("FAIL %s\n", name)
+			for _, f := range failures {
+				fmt.Printf("    %s\n", f)
+			}
+		} else {
+			fmt.Printf("PASS %s (%d examples)\n", name, len(examples[name]))
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("\n%d of %d tokens failed\n", failed, len(names))
+		os.Exit(1)
+	}
+}
+
+/**
+	One example line from testedTokens.txt: "NAME + word" must match, "NAME - word" must not.
+*/
+type example struct {
+	word string
+	positive bool
+	line int
+}
+
+/**
+	Parses examples, one per line "NAME + word" or "NAME - word" (word may contain spaces).
+	Empty lines and lines starting with '#' are skipped. Returns an error for an unknown token.
+*/
+func parseExamples(testFile string, tokens map[string]*types.Token) (examples map[string][]example, err error) {
+	examples = make(map[string][]example)
+	lines := strings.Split(strings.Replace(testFile, "\r\n", "\n", -1), "\n")
+	for n := range lines {
+		if lines[n] == "" || lines[n][0] == '#' {
+			continue
+		}
+		parts := strings.SplitN(lines[n], " ", 3)
+		if len(parts) < 3 || (parts[1] != "+" && parts[1] != "-") {
+			return nil, errors.New("Wrong example on line "+strconv.Itoa(n+1)+": '"+lines[n]+"'")
+		}
+		if tokens[parts[0]] == nil {
+			return nil, errors.New("Example for a token that is not defined on line "+strconv.Itoa(n+1)+": "+parts[0])
+		}
+		examples[parts[0]] = append(examples[parts[0]], example{word: parts[2], positive: parts[1] == "+", line: n+1})
+	}
+	return examples, nil
+}
+
+/**
+	Returns description of every example of token 't' that fails. A positive example
+	of a typed token also has to convert to the type, as jsonizer would output it.
+*/
+func runExamples(t *types.Token, examples []example) (failures []string) {
+	for _, ex := range examples {
+		matched := t.Match(ex.word)
+		if matched && ex.positive && t.Kind != "" {
+			if _, err := types.Converters[t.Kind](ex.word); err != nil {
+				failures = append(failures, fmt.Sprintf("line %d: %q matches but does not convert to %s: %v", ex.line, ex.word, t.Kind, err))
+				continue
+			}
+		}
+		if matched != ex.positive {
+			should := "should match"
+			if !ex.positive {
+				should = "should not match"
+			}
+			failures = append(failures, fmt.Sprintf("line %d: %q %s", ex.line, ex.word, should))
+		}
+	}
+	return failures
 }
-	
\ No newline at end of file
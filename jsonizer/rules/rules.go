@@ -0,0 +1,1083 @@
+/**
+	Rules of jsonizer: matches of patterns.txt, tokenizers and presets, and the matching of lines
+	with their explanation, so that other programs can process or explain lines as jsonizer does:
+
+		matches, priorities, err := rules.ParseMatches(patternsFile)
+		tokens, _, err := types.Parse(tokensFile)
+		set, err := rules.New(matches, priorities, tokens, rules.Tokenizers["space"])
+		result, explained := set.Process(0, line), set.Explain(line)
+*/
+package rules
+import ("fmt"; "strings"; "regexp"; "strconv"; "errors"; "sort"; "jsonizer/types")
+
+/*******************            Rule set functions          *******************/
+
+/**
+	Everything needed to process one line of text: parsed patterns.txt and tokens.txt
+	and the options chosen by flags.
+
+	@field 'pOnMatchLine' SPECIFIC WORDs of each match, searched for by SBOM
+*/
+type Set struct {
+	Matches [][]Element
+	Priorities []int
+	pOnMatchLine map[int][]string
+	tokens map[string]*types.Token
+	tokenize func(line string) []Field
+	Anywhere bool
+	Policy string
+	ExplainLines bool
+}
+
+/**
+	Prepares rule set, returns an error if a match uses a token that is not defined.
+	Options are set to their defaults (anchored at the first word, longest policy).
+*/
+func New(matches [][]Element, priorities []int, tokens map[string]*types.Token, tokenize func(line string) []Field) (*Set, error) {
+	rules := &Set{Matches: matches, Priorities: priorities, tokens: tokens, tokenize: tokenize, Policy: "longest"}
+	rules.pOnMatchLine = make(map[int][]string)
+	for i := range matches {
+		rules.pOnMatchLine[i] = make([]string, 0)
+		for _, e := range matches[i] {
+			if e.kind == '{' {
+				rules.pOnMatchLine[i] = addWord(rules.pOnMatchLine[i], e.value)
+			} else if e.kind == '<' && tokens[e.value] == nil {
+				return nil, errors.New("NO TOKEN DEFINITION in tokens.txt FOR: "+e.value)
+			}
+		}
+	}
+	return rules, nil
+}
+
+/**
+	Finds all matches on line number 'n' (from 0) and returns the ones chosen by the policy.
+*/
+func (rules *Set) Process(n int, line string) Result {
+	found := make(map[int][]Capture)
+	wordOccurences := make(map[string][]int)
+	currentLine := rules.tokenize(line)
+	for m := range rules.Matches {
+		if len(rules.Matches[m]) == 0 { //empty line in patterns.txt
+			continue
+		}
+		if len(rules.pOnMatchLine[m]) > 0 { //if there are words in this match, search for them
+			wordOccurences = searchSBOM(rules.pOnMatchLine[m], line)
+		}
+		failed := newFailed(rules.Matches[m], currentLine)
+		for w := 0; w <= rules.lastStart(currentLine); w++ {
+			captured, ok := matchFrom(rules.Matches[m], 0, currentLine, w, wordOccurences, rules.tokens, nil, failed)
+			if ok {
+				currentCaptures := make([]Capture, 0) //empty for a match with no tokens to print
+				for _, c := range captured {
+					currentCaptures = addCapture(currentCaptures, c)
+				}
+				found[m] = currentCaptures
+				break
+			}
+		}
+	}
+	r := Result{Line: n, Errs: make([]string, 0)}
+	r.Matches = selectMatches(found, rules.Matches, rules.Priorities, rules.Policy)
+	for _, m := range r.Matches {
+		r.Captured = append(r.Captured, found[m])
+		r.Errs = append(r.Errs, convertAll(found[m], rules.tokens)...)
+	}
+	if rules.ExplainLines {
+		r.Explained = rules.ExplainText(n, line)
+	}
+	return r
+}
+
+/**
+	Result for one line of text.txt.
+
+	@field 'Line' index of the line
+	@field 'Matches' indexes of the matches to output, empty for NO_MATCH
+	@field 'Captured' tokens of each of 'matches'
+	@field 'Errs' conversion errors
+	@field 'Explained' explanation written before the result (-explain)
+*/
+type Result struct {
+	Line int
+	Matches []int
+	Captured [][]Capture
+	Errs []string
+	Explained string
+}
+
+/**
+	Returns indexes of the matches found on one line ('found') to be output, chosen by -policy:
+	@first the first match in patterns.txt
+	@longest the match with most words (gaps not counted), the first one if there are more
+	@all all found matches
+	Higher priority (@N in patterns.txt) always goes first.
+*/
+func selectMatches(found map[int][]Capture, matches [][]Element, priorities []int, policy string) []int {
+	selected := make([]int, 0, len(found))
+	for m := range found {
+		selected = append(selected, m)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		a, b := selected[i], selected[j]
+		if priorities[a] != priorities[b] {
+			return priorities[a] > priorities[b]
+		}
+		if policy == "longest" && wordCount(matches[a]) != wordCount(matches[b]) {
+			return wordCount(matches[a]) > wordCount(matches[b])
+		}
+		return a < b
+	})
+	if policy != "all" && len(selected) > 1 {
+		selected = selected[:1]
+	}
+	return selected
+}
+
+/**
+	Returns number of elements of match 'm' that are not gaps.
+*/
+func wordCount(m []Element) (count int) {
+	for _, e := range m {
+		if e.kind != '.' {
+			count++
+		}
+	}
+	return count
+}
+
+/*******************          Explain functions          *******************/
+
+/**
+	One comparison of an element of a match with a word of the line.
+
+	@field 'Element' index of the element in the match
+	@field 'Word' index of the word, '-1' if the line has no more words
+	@field 'Text' the word
+	@field 'Test' what the word was compared with: regex, type or SPECIFIC WORD
+	@field 'OK' 'true' if the word matched
+*/
+type Step struct {
+	Element int
+	Word int
+	Text string
+	Test string
+	OK bool
+}
+
+/**
+	How one match was tried on a line.
+
+	@field 'Match' index of the match
+	@field 'Start' word the successful try started at (or the last try if none was successful)
+	@field 'Steps' all comparisons, also those of tries that were given up (backtracking)
+	@field 'Matched' 'true' if the match was found
+	@field 'Failed' the comparison that failed furthest in the match, nil if 'matched'
+*/
+type Explanation struct {
+	Match int
+	Start int
+	Steps []Step
+	Matched bool
+	Failed *Step
+}
+
+func newStep(e Element, index int, words []Field, w int, tokens map[string]*types.Token, ok bool) Step {
+	st := Step{Element: index, Word: -1, OK: ok}
+	if w < len(words) {
+		st.Word, st.Text = w, words[w].Text
+	}
+	if e.kind == '{' {
+		st.Test = "SPECIFIC WORD "+e.value
+	} else if e.kind == '*' {
+		st.Test = "at least one word"
+	} else if t := tokens[e.value]; t != nil && t.Strict {
+		st.Test = "type "+t.Kind
+	} else if t != nil {
+		st.Test = "regex "+t.Regex.String()
+	}
+	return st
+}
+
+/**
+	Explains why each match did or did not match line 'line' - what every element was compared with.
+	Works the same way as 'process', only slower.
+*/
+func (rules *Set) Explain(line string) []Explanation {
+	explained := make([]Explanation, 0)
+	currentLine := rules.tokenize(line)
+	for m := range rules.Matches {
+		if len(rules.Matches[m]) == 0 {
+			continue
+		}
+		wordOccurences := make(map[string][]int)
+		if len(rules.pOnMatchLine[m]) > 0 {
+			wordOccurences = searchSBOM(rules.pOnMatchLine[m], line)
+		}
+		ex := Explanation{Match: m, Steps: make([]Step, 0)}
+		failed := newFailed(rules.Matches[m], currentLine)
+		for w := 0; w <= rules.lastStart(currentLine) && !ex.Matched; w++ {
+			ex.Start = w
+			_, ex.Matched = matchFrom(rules.Matches[m], 0, currentLine, w, wordOccurences, rules.tokens, &ex.Steps, failed)
+		}
+		if !ex.Matched {
+			for i := range ex.Steps {
+				if !ex.Steps[i].OK && (ex.Failed == nil || ex.Steps[i].Element >= ex.Failed.Element) {
+					ex.Failed = &ex.Steps[i]
+				}
+			}
+		}
+		explained = append(explained, ex)
+	}
+	return explained
+}
+
+/**
+	Returns explanation of line 'n' in a readable form, to be followed by the normal result (-explain).
+*/
+func (rules *Set) ExplainText(n int, line string) string {
+	out := "Line "+strconv.Itoa(n+1)+": "+strconv.Quote(line)+"\n  Words:"
+	for i, w := range rules.tokenize(line) {
+		out = out+" ["+strconv.Itoa(i)+"]"+strconv.Quote(w.Text)
+	}
+	out = out+"\n"
+	for _, ex := range rules.Explain(line) {
+		m := rules.Matches[ex.Match]
+		out = out+"  Match "+strconv.Itoa(ex.Match+1)+":"
+		for _, e := range m {
+			out = out+" "+e.String()
+		}
+		if ex.Matched {
+			out = out+" - MATCHED from word "+strconv.Itoa(ex.Start)+"\n"
+		} else {
+			out = out+" - NO_MATCH\n"
+		}
+		for _, st := range ex.Steps {
+			word := "end of line"
+			if st.Word >= 0 {
+				word = "word "+strconv.Itoa(st.Word)+" "+strconv.Quote(st.Text)
+			}
+			result := "ok"
+			if !st.OK {
+				result = "FAIL"
+			}
+			out = out+fmt.Sprintf("    %-4s %s: %s - %s\n", result, m[st.Element].String(), word, st.Test)
+		}
+		if ex.Failed != nil {
+			word := "the line has no more words"
+			if ex.Failed.Word >= 0 {
+				word = "word "+strconv.Itoa(ex.Failed.Word)+" "+strconv.Quote(ex.Failed.Text)+" does not match "+ex.Failed.Test
+			}
+			out = out+"    failed at element "+strconv.Itoa(ex.Failed.Element+1)+" "+m[ex.Failed.Element].String()+": "+word+"\n"
+		}
+	}
+	return out+"  Result: "
+}
+
+/*******************            SBOM functions          *******************/
+
+func searchSBOM(p []string, t string) map[string][]int {
+	lmin := computeMinLength(p)
+	or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+	occurences := make(map[string][]int)
+	pos := 0
+	for pos <= len(t) - lmin {
+			current := 0
+			j := lmin
+			for j >= 1 && stateExists(current, or) {
+					current = getTransition(current, t[pos+j-1], or)
+					j--
+			}
+			word := getWord(pos, pos+lmin-1, t)
+			if stateExists(current, or) && j == 0 && strings.HasPrefix(word, getCommonPrefix(p, f[current], lmin)) {
+					for i := range f[current] {
+							if p[f[current][i]] == getWord(pos, pos-1+len(p[f[current][i]]), t) {
+									occurences[p[f[current][i]]] = intArrayCapUp(occurences[p[f[current][i]]])
+									occurences[p[f[current][i]]][len(occurences[p[f[current][i]]])-1] = pos
+							}
+					}
+					j = 0
+			}
+			pos = pos + j + 1
+	}
+	return occurences
+}
+
+/**
+        Function that builds factor oracle used by sbom.
+*/
+func buildOracleMultiple (p []string) (orToReturn map[int]map[uint8]int, f map[int][]int) {
+        orTrie, stateIsTerminal, f := constructTrie(p)
+        s := make([]int, len(stateIsTerminal)) //supply function
+        i := 0 //root of trie
+        orToReturn = orTrie
+        s[i] = -1
+        order, parents, letters := breadthFirst(orTrie)
+        for _, current := range order { //shallower states first, their supply function is needed
+                o, parent := letters[current], parents[current]
+                down := s[parent]
+                for stateExists(down, orToReturn) && getTransition(down, o, orToReturn) == -1 {
+                        createTransition(down, o, current, orToReturn)
+                        down = s[down]
+                }
+                if stateExists(down, orToReturn) {
+                        s[current] = getTransition(down, o, orToReturn)
+                } else {
+                        s[current] = i
+                }
+        }
+        return orToReturn, f
+}
+
+/**
+        Function that constructs Trie as an automaton for a set of reversed & trimmed strings.
+        
+        @return 'trie' built prefix tree
+        @return 'stateIsTerminal' array of all states and boolean values of their terminality
+        @return 'f' map with keys of pattern indexes and values - arrays of p[i] terminal states
+*/
+func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []bool, f map[int][]int) {
+        trie = make(map[int]map[uint8]int)
+        stateIsTerminal = make([]bool, 1)
+        f = make(map[int][]int) 
+        state := 1
+        createNewState(0, trie)
+        for i:=0; i<len(p); i++ {
+                current := 0
+                j := 0
+                for j < len(p[i]) && getTransition(current, p[i][j], trie) != -1 {
+                        current = getTransition(current, p[i][j], trie)
+                        j++
+                }
+                for j < len(p[i]) {
+                        stateIsTerminal = boolArrayCapUp(stateIsTerminal)
+                        createNewState(state, trie)
+                        stateIsTerminal[state] = false
+                        createTransition(current, p[i][j], state, trie)
+                        current = state
+                        j++
+                        state++
+                }
+                if stateIsTerminal[current] {
+                        newArray := intArrayCapUp(f[current])
+                        newArray[len(newArray)-1] = i
+                        f[current] = newArray
+                } else {
+                        stateIsTerminal[current] = true
+                        f[current] = []int {i}
+                }
+        }
+        return trie, stateIsTerminal, f
+}
+
+/*******************            Rule functions          *******************/
+
+/**
+	One element of a match line in patterns.txt.
+
+	@field 'kind' '<' for TOKEN, '{' for SPECIFIC WORD, '.' for a gap of any number of words,
+		'*' for all remaining words captured under their own key (<*>)
+	@field 'value' token name or word, empty for a gap and <*>
+	@field 'optional' element may be left out (suffix '?')
+*/
+type Element struct {
+	kind uint8
+	value string
+	optional bool
+}
+
+/**
+	Returns the element written back as in patterns.txt.
+*/
+func (e Element) String() string {
+	s := "..."
+	if e.kind == '*' {
+		s = "<*>"
+	} else if e.kind == '<' {
+		s = "<"+e.value+">"
+	} else if e.kind == '{' {
+		s = "{"+e.value+"}"
+	}
+	if e.optional {
+		s = s+"?"
+	}
+	return s
+}
+
+/**
+	Parses content of patterns.txt, one match per line, words separated by spaces.
+	A line may start with "@N", priority of the match (default 0, higher goes first).
+	Returns an error for an unknown expression.
+*/
+func ParseMatches(patternsFile string) (matches [][]Element, priorities []int, err error) {
+	lines := splitLines(patternsFile)
+	matches = make([][]Element, len(lines))
+	priorities = make([]int, len(lines))
+	for i := range lines {
+		matches[i] = make([]Element, 0)
+		for j, word := range strings.Fields(lines[i]) {
+			e := Element{}
+			if j == 0 && len(word) > 1 && word[0] == '@' {
+				priorities[i], err = strconv.Atoi(word[1:])
+				if err != nil {
+					return nil, nil, errors.New("Wrong priority in Match "+strconv.Itoa(i+1)+": '"+word+"'")
+				}
+				continue
+			}
+			if word == "..." || word == "<*>" {
+				e.kind = word[1]
+				matches[i] = append(matches[i], e)
+				continue
+			}
+			if len(word) > 3 && word[len(word)-1] == '?' {
+				e.optional = true
+				word = word[:len(word)-1]
+			}
+			if len(word) < 3 || !((word[0] == '<' && word[len(word)-1] == '>') || (word[0] == '{' && word[len(word)-1] == '}')) {
+				return nil, nil, errors.New("Unknown expression in Match "+strconv.Itoa(i+1)+": '"+word+"'")
+			}
+			e.kind = word[0]
+			e.value = word[1:len(word)-1]
+			matches[i] = append(matches[i], e)
+		}
+	}
+	return matches, priorities, nil
+}
+
+/**
+	Tries to match elements 'm[e:]' of one match against the words of a line starting at word 'w'.
+	Gaps and optional elements are tried in all possible ways (backtracking), so the first
+	successful alignment wins. Whether the rest matches from a pair of element and word does not depend
+	on how it was reached, so failed pairs are remembered and never tried again, which keeps
+	more gaps from multiplying the work by the length of the line.
+
+	@param 'words' words of the line
+	@param 'occ' positions of the SPECIFIC WORDs found by SBOM in the line
+	@param 'tokens' definition of each TOKEN
+	@param 'trace' if not nil, every comparison is added to it (see 'explain')
+	@param 'failed' pairs of element 'e' and word 'w' the rest did not match from, at e*(len(words)+1)+w (see 'newFailed')
+	@return 'captured' matched tokens and their values
+	@return 'ok' true if the rest of the match was found
+*/
+func matchFrom(m []Element, e int, words []Field, w int, occ map[string][]int, tokens map[string]*types.Token, trace *[]Step, failed []bool) (captured []Capture, ok bool) {
+	if e == len(m) {
+		return make([]Capture, 0), true
+	}
+	pair := e*(len(words)+1) + w
+	if failed[pair] {
+		return nil, false
+	}
+	defer func() {
+		failed[pair] = !ok
+	}()
+	if m[e].kind == '*' { //ALL_WORDS - capture the rest of the line
+		return captureAll(e, words, w, tokens, trace)
+	}
+	if m[e].kind == '.' { //GAP - skip any number of words
+		for next := w; next <= len(words); next++ {
+			if captured, ok = matchFrom(m, e+1, words, next, occ, tokens, trace, failed); ok {
+				return captured, true
+			}
+		}
+		return nil, false
+	}
+	matched := w < len(words) && matchElement(m[e], words[w], occ, tokens)
+	if trace != nil {
+		*trace = append(*trace, newStep(m[e], e, words, w, tokens, matched))
+	}
+	if matched {
+		if captured, ok = matchFrom(m, e+1, words, w+1, occ, tokens, trace, failed); ok {
+			if m[e].kind == '<' { //store token + value
+				captured = append([]Capture{{Token: m[e].value, Value: words[w].Text}}, captured...)
+			}
+			return captured, true
+		}
+	}
+	if m[e].optional { //try without this element
+		return matchFrom(m, e+1, words, w, occ, tokens, trace, failed)
+	}
+	return nil, false
+}
+
+/**
+	Returns index of the last word of 'words' a match may start at: the first one, or with -anywhere the last one.
+	A line without words still has the start 0, where a match made only of gaps and optional elements
+	matches it with no words, as it does without -anywhere.
+*/
+func (rules *Set) lastStart(words []Field) int {
+	if !rules.Anywhere || len(words) == 0 {
+		return 0
+	}
+	return len(words) - 1
+}
+
+/**
+	Returns memo of matchFrom for match 'm' on a line of 'words', no pair of element and word failed yet.
+	Every start of the match on the line shares it.
+*/
+func newFailed(m []Element, words []Field) []bool {
+	return make([]bool, (len(m)+1)*(len(words)+1))
+}
+
+/**
+	Captures every word from 'w' under its key ("FIELD" for words without one). A word whose key
+	has a token definition has to match it. At least one word is required.
+
+	@param 'e' index of the <*> element (for 'trace')
+*/
+func captureAll(e int, words []Field, w int, tokens map[string]*types.Token, trace *[]Step) (captured []Capture, ok bool) {
+	captured = make([]Capture, 0)
+	for ; w < len(words); w++ {
+		key := words[w].Key
+		if key == "" {
+			key = "FIELD"
+		}
+		t, defined := tokens[key]
+		matched := !defined || t.Match(words[w].Text)
+		if trace != nil {
+			*trace = append(*trace, newStep(Element{kind: '<', value: key}, e, words, w, tokens, matched))
+		}
+		if !matched {
+			return nil, false
+		}
+		captured = append(captured, Capture{Token: key, Value: words[w].Text})
+	}
+	if len(captured) == 0 && trace != nil {
+		*trace = append(*trace, newStep(Element{kind: '*'}, e, words, w, tokens, false))
+	}
+	return captured, len(captured) > 0
+}
+
+/**
+	Returns 'true' if single element 'e' matches word 'word' of the line.
+*/
+func matchElement(e Element, word Field, occ map[string][]int, tokens map[string]*types.Token) bool {
+	if e.kind == '<' { //REGEX_MATCHING
+		return tokens[e.value].Match(word.Text)
+	}
+	return contains(occ[e.value], word.Pos) //WORD_MATCHING
+}
+
+/*******************          Tokenizer functions          *******************/
+
+/**
+	One word of a line of text.txt.
+
+	@field 'Text' the word itself, without surrounding quotes or brackets
+	@field 'Pos' position of 'text' in the line
+	@field 'Key' name of the value for key=value words, empty otherwise
+*/
+type Field struct {
+	Text string
+	Pos int
+	Key string
+}
+
+/**
+	Functions that split a line into words, selected by -tokenizer.
+*/
+var Tokenizers = map[string]func(line string) []Field {
+	"space": splitOnSpace,
+	"whitespace": func(line string) []Field { return splitGrouped(line, "") },
+	"quote": func(line string) []Field { return splitGrouped(line, "\"") },
+	"bracket": func(line string) []Field { return splitGrouped(line, "\"[") },
+	"csv": func(line string) []Field { return splitSeparated(line, ',', true) },
+	"tsv": func(line string) []Field { return splitSeparated(line, '\t', false) },
+	"kv": splitKeyValue,
+}
+
+/**
+	Splits line on every single space (empty words between two spaces are kept).
+*/
+func splitOnSpace(line string) []Field {
+	words := strings.Split(line, " ")
+	fields := make([]Field, len(words))
+	for w, pos := 0, 0; w < len(words); w++ {
+		fields[w] = Field{Text: words[w], Pos: pos}
+		pos = pos + len(words[w]) + 1
+	}
+	return fields
+}
+
+/**
+	Splits line on runs of whitespace. Text between the opening characters in 'groups'
+	('"' or '[') and their closing pair is one word even if it contains whitespace.
+	The quotes/brackets themselves are not part of the word.
+*/
+func splitGrouped(line, groups string) []Field {
+	fields := make([]Field, 0)
+	i := 0
+	for i < len(line) {
+		if isSpace(line[i]) {
+			i++
+			continue
+		}
+		if strings.IndexByte(groups, line[i]) >= 0 {
+			closing := line[i]
+			if closing == '[' {
+				closing = ']'
+			}
+			end := i+1
+			for end < len(line) && line[end] != closing {
+				if line[end] == '\\' && closing == '"' {
+					end++ //escaped character
+				}
+				end++
+			}
+			if end < len(line) && (end+1 == len(line) || isSpace(line[end+1])) {
+				fields = append(fields, Field{Text: line[i+1:end], Pos: i+1})
+				i = end+1
+				continue
+			}
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		fields = append(fields, Field{Text: line[start:i], Pos: start})
+	}
+	return fields
+}
+
+/**
+	Splits line on separator 'sep'. If 'quoted' is true, a word in double quotes may
+	contain the separator, and "" inside it stands for one quote (CSV).
+*/
+func splitSeparated(line string, sep uint8, quoted bool) []Field {
+	fields := make([]Field, 0)
+	i := 0
+	for {
+		if quoted && i < len(line) && line[i] == '"' {
+			var text []byte
+			end := i+1
+			for end < len(line) {
+				if line[end] == '"' && end+1 < len(line) && line[end+1] == '"' {
+					text = append(text, '"')
+					end = end+2
+				} else if line[end] == '"' {
+					break
+				} else {
+					text = append(text, line[end])
+					end++
+				}
+			}
+			fields = append(fields, Field{Text: string(text), Pos: i+1})
+			i = end+1
+			for i < len(line) && line[i] != sep { //skip garbage after closing quote
+				i++
+			}
+		} else {
+			end := strings.IndexByte(line[i:], sep)
+			if end < 0 {
+				end = len(line)-i
+			}
+			fields = append(fields, Field{Text: line[i:i+end], Pos: i})
+			i = i+end
+		}
+		if i >= len(line) {
+			return fields
+		}
+		i++ //separator
+	}
+}
+
+/**
+	Splits line into key=value words (values may be quoted). Word 'text' is the value,
+	'key' the name. Words without '=' are kept whole with an empty key.
+*/
+func splitKeyValue(line string) []Field {
+	fields := make([]Field, 0)
+	i := 0
+	for i < len(line) {
+		if isSpace(line[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(line) && !isSpace(line[i]) && line[i] != '=' {
+			i++
+		}
+		if i == len(line) || isSpace(line[i]) || i == start { //no key
+			for i < len(line) && !isSpace(line[i]) {
+				i++
+			}
+			fields = append(fields, Field{Text: line[start:i], Pos: start})
+			continue
+		}
+		key := line[start:i]
+		i++ //'='
+		if i < len(line) && line[i] == '"' {
+			end := i+1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end > len(line) {
+				end = len(line)
+			}
+			fields = append(fields, Field{Text: line[i+1:end], Pos: i+1, Key: key})
+			i = end+1
+			continue
+		}
+		valueStart := i
+		for i < len(line) && !isSpace(line[i]) {
+			i++
+		}
+		fields = append(fields, Field{Text: line[valueStart:i], Pos: valueStart, Key: key})
+	}
+	return fields
+}
+
+/**
+	Returns 'true' for space, tab and other ASCII whitespace.
+*/
+func isSpace(c uint8) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+/*******************            Preset functions          *******************/
+
+/**
+	Built-in parser for a common log format, selected by -format.
+
+	@field 'Tokenize' splits a line into words named by their key
+	@field 'Tokens' default token definitions (as in tokens.txt) checking and typing some of the words,
+		tokens.txt can override them or add definitions for other keys
+*/
+type Preset struct {
+	Tokenize func(line string) []Field
+	Tokens string
+}
+
+const clfPattern = `^(?P<HOST>\S+) (?P<IDENT>\S+) (?P<USER>\S+) \[(?P<TIME>[^\]]+)\] "(?:(?P<METHOD>[A-Z]+) (?P<PATH>\S+)(?: (?P<PROTOCOL>[^"\s]+))?|(?P<REQUEST>[^"]*))" (?P<STATUS>\S+) (?P<SIZE>\S+)`
+const clfTokens = "TIME:timestamp\nSTATUS:int ^[1-5][0-9][0-9]$\nSIZE ^([0-9]+|-)$"
+const syslogTokens = "PRI:int ^[0-9]{1,3}$\nVERSION:int\nTIMESTAMP:timestamp"
+
+/**
+	Presets for -format. Nginx uses the Apache combined format by default.
+*/
+var Presets = map[string]Preset {
+	"clf": {splitRegex(regexp.MustCompile(clfPattern+`\s*$`)), clfTokens},
+	"combined": {splitRegex(regexp.MustCompile(clfPattern+` "(?P<REFERER>[^"]*)" "(?P<AGENT>[^"]*)"\s*$`)), clfTokens},
+	"syslog": {splitRegex(regexp.MustCompile(`^(?:<(?P<PRI>[0-9]{1,3})>)?(?P<TIMESTAMP>[A-Z][a-z][a-z] [ 0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]) (?P<HOST>\S+) (?P<TAG>[^:\[\s]+)(?:\[(?P<PID>[^\]]*)\])?: ?(?P<MSG>.*)$`)), syslogTokens},
+	"rfc5424": {splitRegex(regexp.MustCompile(`^<(?P<PRI>[0-9]{1,3})>(?P<VERSION>[0-9]{1,2}) (?P<TIMESTAMP>\S+) (?P<HOST>\S+) (?P<APP>\S+) (?P<PROCID>\S+) (?P<MSGID>\S+) (?P<SD>-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (?P<MSG>.*))?$`)), syslogTokens},
+	"logfmt": {splitLogfmt, ""},
+}
+
+func init() {
+	Presets["apache"] = Presets["combined"]
+	Presets["nginx"] = Presets["combined"]
+	Presets["rfc3164"] = Presets["syslog"]
+}
+
+/**
+	Returns tokenizer that matches the whole line by regex 're' and returns one word
+	for each named group that took part in the match. The line gives no words if 're' does not match.
+*/
+func splitRegex(re *regexp.Regexp) func(line string) []Field {
+	names := re.SubexpNames()
+	return func(line string) []Field {
+		fields := make([]Field, 0)
+		loc := re.FindStringSubmatchIndex(line)
+		if loc == nil {
+			return fields
+		}
+		for i := 1; i < len(names); i++ {
+			if names[i] != "" && loc[2*i] >= 0 {
+				fields = append(fields, Field{Text: line[loc[2*i]:loc[2*i+1]], Pos: loc[2*i], Key: names[i]})
+			}
+		}
+		return fields
+	}
+}
+
+/**
+	Splits logfmt line into key=value words. A key without a value stands for "true".
+*/
+func splitLogfmt(line string) []Field {
+	fields := splitKeyValue(line)
+	for i := range fields {
+		if fields[i].Key == "" {
+			fields[i].Key = fields[i].Text
+			fields[i].Text = "true"
+		}
+	}
+	return fields
+}
+
+/*******************            Type functions          *******************/
+
+/**
+	Converts values of captured tokens with a type. A value that does not convert is left as it is
+	and the reason is returned in 'errs'.
+*/
+func convertAll(captured []Capture, tokens map[string]*types.Token) (errs []string) {
+	errs = make([]string, 0)
+	for i := range captured {
+		t, ok := tokens[captured[i].Token]
+		if !ok || t.Kind == "" {
+			continue
+		}
+		value, err := types.Converters[t.Kind](captured[i].Value)
+		if err != nil {
+			errs = append(errs, captured[i].Token+" = "+captured[i].Value+": "+t.Kind+": "+errorText(err))
+			continue
+		}
+		captured[i].Typed = value
+	}
+	return errs
+}
+
+/**
+	Returns short reason of conversion error 'err' (without the repeated input).
+*/
+func errorText(err error) string {
+	if numErr, ok := err.(*strconv.NumError); ok {
+		return numErr.Err.Error()
+	}
+	return err.Error()
+}
+
+/*******************          String functions          *******************/
+/**
+        Returns a prefix size 'lmin' for one string 'p' of first index found in 'f'.
+        It is not needed to compare all the strings from 'p' indexed in 'f',
+        thanks to the konwledge of 'lmin'.
+*/
+func getCommonPrefix(p []string, f []int, lmin int) string {
+        return p[f[0]][:lmin]
+}
+
+/**
+        Function that takes a set of strings 'p' and their wanted 'length'
+        and then trims each string in that set to have desired 'length'.
+*/
+func trimToLength(p []string, length int) (trimmedP []string) {
+        trimmedP = make([]string, len(p))
+        for i := range p {
+                trimmedP[i] = p[i][:length]
+        }
+        return trimmedP
+}
+
+/**        
+        Function that takes an array of strings and reverses it.
+*/
+func reverseAll(s []string) (reversed []string) {
+        reversed = make([]string, len(s))
+        for i := 0; i < len(s); i++ {
+                reversed[i] = reverse(s[i])
+        }
+        return reversed
+}
+
+/**        
+        Function that takes a single string and reverses it byte by byte
+        (the oracle works on bytes, so this holds for any text, not only UTF-8).
+*/
+func reverse(s string) string {
+    l := len(s)
+    m := make([]uint8, l)
+    for i := 0; i < len(s); i++ {
+        l--
+        m[l] = s[i]
+    }
+    return string(m)
+}
+
+/**
+	Splits file content into lines, works with both "\r\n" and "\n" line endings.
+*/
+func splitLines(file string) []string {
+	return strings.Split(strings.Replace(file, "\r\n", "\n", -1), "\n")
+}
+
+/**
+	One captured token, the word it matched and the word converted to token's type (nil if untyped).
+*/
+type Capture struct {
+	Token string
+	Value string
+	Typed interface{}
+}
+
+/**
+	Check's if capture 'c' exists in array 's', if not - add's it.
+*/
+func addCapture(s []Capture, c Capture) []Capture {
+	for i := range s {
+		if s[i].Token == c.Token && s[i].Value == c.Value {
+			return s
+		}
+	}
+	return append(s, c)
+}
+
+/**
+	Check's if word 'w 'exist in array of strings 's', if not - add's it.
+	Returns 's' containing word 'w'.
+*/
+func addWord(s []string, w string) (output []string) {
+	for i := range s {
+		if s[i] == w {
+			return s
+		}
+	}
+	s = stringArrayCapUp(s)
+	s[len(s)-1] = w
+	return s
+}
+
+/**
+	Function that returns word found in text 't' at position range 'begin' to 'end'.
+*/
+func getWord(begin, end int, t string) string {
+	for end >= len(t) {
+		return ""
+	}
+	d := make([]uint8, end-begin+1)
+	for j, i := 0, begin; i <= end; i, j = i+1, j+1 {
+		d[j] = t[i]
+	}
+	return string(d)
+}
+
+/**
+        Function that computes minimal length string in a set of strings.
+*/
+func computeMinLength(p []string) (lmin int){
+        lmin = len(p[0])
+        for i:=1; i<len(p); i++ {
+                if (len(p[i])<lmin) {
+                        lmin = len(p[i])
+                }
+        }
+        return lmin
+}
+
+/*******************            Array functions            *******************/
+/**
+	Functions 'type'ArrayCapUp dynamically increases an 'type's array 
+	maximum size by 1. (copy(dst,src))
+*/
+func byteArrayCapUp (old []byte)(new []byte) {
+	new = make([]byte, cap(old)+1)
+	copy(new, old)  
+	return new
+}
+
+func intArrayCapUp (old []int)(new []int) {
+	new = make([]int, cap(old)+1)
+	copy(new, old) 
+	return new
+}
+
+
+func boolArrayCapUp (old []bool)(new []bool) {
+	new = make([]bool, cap(old)+1)
+	copy(new, old)
+	return new
+}
+
+func stringArrayCapUp (old []string)(new []string) {
+	new = make([]string, cap(old)+1)
+	copy(new, old)  //copy(dst,src)
+	return new
+}
+
+/**
+	Concats two arrays of int's into one.
+*/
+func arrayUnion (to, from []int) (concat []int) {
+	concat = to
+	for i := range(from) {
+		if (!contains(concat, from[i])) {
+			concat = intArrayCapUp(concat)
+			concat[len(concat)-1] = from[i]
+		}
+	}
+	return concat
+}
+
+/**
+	Returns 'true' if array of int's 's' contains int 'e', 'false' otherwise.
+	
+	@author Mostafa http://stackoverflow.com/a/10485970
+*/
+func contains(s []int, e int) bool {
+    for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+    return false
+}
+
+/*******************          Automaton functions          *******************/
+/**
+	Function that returns all states of a trie except its root in breadth-first order,
+	with parent of each state and letter of the transition from the parent.
+	Used for trie where there is only one parent.
+	@param 'at' automaton
+*/
+func breadthFirst(at map[int]map[uint8]int) (order []int, parents []int, letters []uint8) {
+	parents, letters = make([]int, len(at)), make([]uint8, len(at))
+	queue := []int{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c := 0; c < 256; c++ {
+			endState := getTransition(state, uint8(c), at)
+			if endState != -1 {
+				parents[endState], letters[endState] = state, uint8(c)
+				order = append(order, endState)
+				queue = append(queue, endState)
+			}
+		}
+	}
+	return order, parents, letters
+}
+
+/**
+	Automaton function for creating a new state 'state'.
+	@param 'at' automaton
+*/
+func createNewState(state int, at map[int]map[uint8]int) {
+	at[state] = make(map[uint8]int)
+}
+
+/**
+ 	Creates a transition for function σ(state,letter) = end.
+	@param 'at' automaton
+*/
+func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
+	at[fromState][overChar]= toState
+}
+
+/**
+	Returns ending state for transition σ(fromState,overChar), '-1' if there is none.
+	@param 'at' automaton
+*/
+func getTransition(fromState int, overChar uint8, at map[int]map[uint8]int)(toState int) {
+	if (!stateExists(fromState, at)) {
+		return -1
+	}
+	toState, ok := at[fromState][overChar]
+	if (ok == false) {
+		return -1	
+	}
+	return toState
+}
+
+/**
+	Checks if state 'state' exists. Returns 'true' if it does, 'false' otherwise.
+	@param 'at' automaton
+*/
+func stateExists(state int, at map[int]map[uint8]int)bool {
+	_, ok := at[state]
+	if (!ok || state == -1 || at[state] == nil) {
+		return false
+	}
+	return true
+}
\ No newline at end of file
@@ -0,0 +1,125 @@
+package rules
+
+import ("testing"; "io/ioutil"; "path/filepath"; "reflect"; "strings"; "time"; "jsonizer/types")
+
+/**
+	Gaps are not retried from where the rest of the match already failed: a match with many gaps
+	that fails on a long line (also with -anywhere and -explain) takes polynomial time, not exponential.
+*/
+func TestGapsOnLongLine(t *testing.T) {
+	tokens, _, err := types.Parse("WORD ^[a-z]+$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches, priorities, err := ParseMatches("... <WORD> ... <WORD> ... <WORD> ... <WORD> ... {zzz}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := New(matches, priorities, tokens, splitOnSpace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules.Anywhere = true
+	line := strings.TrimSpace(strings.Repeat("word ", 150))
+	done := make(chan bool)
+	go func() {
+		if r := rules.Process(0, line); len(r.Matches) != 0 {
+			t.Errorf("matched %v", r.Matches)
+		}
+		if ex := rules.Explain(line); len(ex) != 1 || ex[0].Matched {
+			t.Errorf("explained as matched")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("matching gaps on a line of 150 words takes more than 5 seconds")
+	}
+}
+
+
+/**
+	Run with: go test -fuzz FuzzParseMatches ./rules
+	Parsed matches written back by element.String have to parse to the same matches.
+	Inputs that failed are saved in testdata/fuzz/FuzzParseMatches and checked by every go test.
+*/
+func FuzzParseMatches(f *testing.F) {
+	f.Add("<IP> <WORD> <IP> {drakula}\n@2 <IP> ... {5}? <*>")
+	f.Fuzz(func(t *testing.T, patterns string) {
+		matches, priorities, err := ParseMatches(patterns)
+		if err != nil {
+			return
+		}
+		if len(matches) != len(priorities) {
+			t.Fatalf("%d matches, but %d priorities", len(matches), len(priorities))
+		}
+		lines := make([]string, len(matches))
+		for i := range matches {
+			words := make([]string, len(matches[i]))
+			for j := range matches[i] {
+				words[j] = matches[i][j].String()
+			}
+			lines[i] = strings.Join(words, " ")
+		}
+		again, _, err := ParseMatches(strings.Join(lines, "\n"))
+		if err != nil || !reflect.DeepEqual(matches, again) {
+			t.Errorf("%q written back as %q parses to %v (%v)", patterns, lines, again, err)
+		}
+	})
+}
+
+
+/**
+	Run with: go test -fuzz FuzzProcess ./rules
+	Any patterns.txt (with tokens.txt of jsonizer) on any line must not crash,
+	found matches have to be among the patterns and explain has to agree with process.
+*/
+func FuzzProcess(f *testing.F) {
+	tokFile, err := ioutil.ReadFile(filepath.Join("..", "tokens.txt"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	tokens, _, err := types.Parse(string(tokFile))
+	if err != nil {
+		f.Fatal(err)
+	}
+	pFile, err := ioutil.ReadFile(filepath.Join("..", "patterns.txt"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	text, err := ioutil.ReadFile(filepath.Join("..", "text.txt"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, line := range splitLines(string(text))[:10] {
+		f.Add(string(pFile), line, false)
+	}
+	f.Add("<IP> ... {-}? <*>\n@1 {-} <WORD>?", "1.2.3.4 x - y", true)
+	f.Fuzz(func(t *testing.T, patterns, line string, anywhere bool) {
+		matches, priorities, err := ParseMatches(patterns)
+		if err != nil {
+			return
+		}
+		rules, err := New(matches, priorities, tokens, splitOnSpace)
+		if err != nil {
+			return
+		}
+		rules.Anywhere, rules.Policy = anywhere, "all"
+		r := rules.Process(1, line)
+		matched := 0
+		for _, m := range r.Matches {
+			if m < 0 || m >= len(matches) {
+				t.Fatalf("%q on %q: match %d does not exist", patterns, line, m)
+			}
+		}
+		for _, e := range rules.Explain(line) {
+			if e.Matched {
+				matched++
+			}
+		}
+		if matched != len(r.Matches) {
+			t.Errorf("%q on %q: explain found %d matches, process %d", patterns, line, matched, len(r.Matches))
+		}
+	})
+}
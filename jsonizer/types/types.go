@@ -0,0 +1,193 @@
+/**
+	Token definitions of tokens.txt and the types their values are converted to,
+	shared by jsonizer and its regex tester, so that both read tokens.txt the same way.
+*/
+package types
+import ("errors"; "flag"; "net"; "os"; "regexp"; "strconv"; "strings"; "time")
+
+/*******************            Type functions          *******************/
+
+/**
+	Definition of one TOKEN from tokens.txt.
+
+	@field 'Regex' regex the word has to match, nil if there is none
+	@field 'Kind' type the value is converted to (see 'Converters'), empty for a string
+	@field 'Strict' there is no regex, the word has to convert to 'Kind' instead
+*/
+type Token struct {
+	Regex *regexp.Regexp
+	Kind string
+	Strict bool
+}
+
+/**
+	Returns 'true' if word 'w' matches the token.
+*/
+func (t *Token) Match(w string) bool {
+	if t.Strict {
+		_, err := Converters[t.Kind](w)
+		return err == nil
+	}
+	return t.Regex.MatchString(w)
+}
+
+/**
+	Functions that convert a word to the type of a token ("NAME:type" in tokens.txt).
+*/
+var Converters = map[string]func(w string) (interface{}, error) {
+	"string": func(w string) (interface{}, error) { return w, nil },
+	"int": func(w string) (interface{}, error) { return strconv.ParseInt(w, 10, 64) },
+	"float": func(w string) (interface{}, error) { return strconv.ParseFloat(w, 64) },
+	"ip": func(w string) (interface{}, error) {
+		ip := net.ParseIP(w)
+		if ip == nil {
+			return nil, errors.New("not an IP address")
+		}
+		return ip.String(), nil
+	},
+	"timestamp": ParseTimestamp,
+}
+
+/**
+	Layouts (Go time format) tried by the timestamp type after the ones given by -layout.
+	Layout without a year gets the year of the reference (see ParseTimestamp), without a zone UTC.
+*/
+var DefaultLayouts = []string{time.RFC3339Nano, "02/Jan/2006:15:04:05 -0700", "2006-01-02 15:04:05", "Jan _2 15:04:05", "2/1/2006", "2/1/06"}
+
+/**
+	Values of a flag that can be given more times, an empty value clears the ones given before.
+*/
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	if value == "" {
+		*l = nil
+		return nil
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+/**
+	User defined (command line flags, see DefineFlags).
+
+	@layout Go time layout for timestamp tokens, can be given more times
+	@year year of timestamps without one (syslog), 0 reads them relative to the modification time of the file
+*/
+var layouts listFlag
+var year int
+
+/**
+	Defines the flags of the types on 'flags' (flag.CommandLine in the programs).
+*/
+func DefineFlags(flags *flag.FlagSet) {
+	flags.Var(&layouts, "layout", "Go time layout for timestamp tokens, tried before the default ones (can be given more times)")
+	flags.IntVar(&year, "year", 0, "year of timestamps without one (syslog), 0 reads them relative to the modification time of the file")
+}
+
+/**
+	Modification time of the input file, zero when the current time is the reference (see SetReference).
+*/
+var modified time.Time
+
+/**
+	Sets the reference for reading input file 'path' ("" or "-" for stdin): the modification time of the file,
+	as no line of it was written later. Stdin and a followed file, whose lines are being written while they are read,
+	use the current time. Flag -year overrides both.
+*/
+func SetReference(path string, follow bool) error {
+	modified = time.Time{}
+	if path == "" || path == "-" || follow {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	modified = info.ModTime()
+	return nil
+}
+
+/**
+	Returns the time timestamps without a year are read relative to: the end of year -year if it is given,
+	else the modification time of the input file, else the current time.
+*/
+func reference() time.Time {
+	if year != 0 {
+		return time.Date(year + 1, time.January, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)
+	}
+	if !modified.IsZero() {
+		return modified
+	}
+	return time.Now()
+}
+
+/**
+	Converts word 'w' to an RFC3339 timestamp using the first layout that fits.
+	Timestamp without a year (syslog) gets the year of the reference, or the year before, if it would be
+	more than a day after the reference: "Dec 31" read on the 2nd of January was written in the last year.
+	The day covers the zone, which a timestamp without one may be written in.
+*/
+func ParseTimestamp(w string) (interface{}, error) {
+	for _, tried := range [][]string{layouts, DefaultLayouts} {
+		for _, layout := range tried {
+			t, err := time.Parse(layout, w)
+			if err == nil {
+				if t.Year() == 0 {
+					now := reference()
+					t = t.AddDate(now.Year(), 0, 0)
+					if t.After(now.Add(24 * time.Hour)) {
+						t = t.AddDate(-1, 0, 0)
+					}
+				}
+				return t.Format(time.RFC3339Nano), nil
+			}
+		}
+	}
+	return nil, errors.New("no layout fits")
+}
+
+/*******************          String functions          *******************/
+/**
+	Parses content of tokens.txt, one definition per line: "NAME regex" or "NAME:type regex".
+	Empty lines are skipped. The regex may be left out for a typed token ("IP:ip"),
+	such token matches every word that converts to its type.
+	Returns also the names of the tokens in the order of the file.
+*/
+func Parse(tokenFile string) (tokens map[string]*Token, names []string, err error) {
+	tokens = make(map[string]*Token)
+	tokenLines := strings.Split(strings.Replace(tokenFile, "\r\n", "\n", -1), "\n")
+	for n := range tokenLines {
+		if tokenLines[n] == "" {
+			continue
+		}
+		definition := strings.SplitN(tokenLines[n], " ", 2) //regex may contain spaces
+		name, kind := definition[0], ""
+		if colon := strings.IndexByte(name, ':'); colon >= 0 {
+			name, kind = name[:colon], name[colon+1:]
+			if _, ok := Converters[kind]; !ok {
+				return nil, nil, errors.New("Unknown type in tokens.txt on line "+strconv.Itoa(n+1)+": '"+kind+"'")
+			}
+		}
+		if name == "" || (len(definition) < 2 && kind == "") {
+			return nil, nil, errors.New("Wrong token definition in tokens.txt on line "+strconv.Itoa(n+1)+": '"+tokenLines[n]+"'")
+		}
+		if _, ok := tokens[name]; ok { //first definition wins
+			continue
+		}
+		t := &Token{Kind: kind, Strict: len(definition) < 2}
+		if !t.Strict {
+			t.Regex, err = regexp.Compile(definition[1])
+			if err != nil {
+				return nil, nil, errors.New("Wrong regex in tokens.txt for "+name+": "+err.Error())
+			}
+		}
+		tokens[name] = t
+		names = append(names, name)
+	}
+	return tokens, names, nil
+}
@@ -0,0 +1,41 @@
+package types
+
+import ("testing"; "time")
+
+/**
+	Timestamps without a year get the year of the reference, the ones later than it by more than a day
+	the year before (written before New Year, read after it).
+*/
+func TestTimestampYear(t *testing.T) {
+	defer func(previous time.Time) { modified = previous }(modified)
+	modified = time.Date(2027, time.January, 2, 10, 0, 0, 0, time.UTC)
+	for w, expected := range map[string]string{"Dec 31 23:59:00": "2026-12-31T23:59:00Z", "Jan  2 09:00:00": "2027-01-02T09:00:00Z",
+		"Jan  3 09:00:00": "2027-01-03T09:00:00Z", "Jan  4 12:00:00": "2026-01-04T12:00:00Z", "2027-01-05 08:00:00": "2027-01-05T08:00:00Z"} {
+		if typed, err := ParseTimestamp(w); err != nil || typed != expected {
+			t.Errorf("%q: %v (%v), expected %s", w, typed, err, expected)
+		}
+	}
+	year = 2023
+	defer func() { year = 0 }()
+	if typed, err := ParseTimestamp("Jan  4 12:00:00"); err != nil || typed != "2023-01-04T12:00:00Z" {
+		t.Errorf("with -year 2023: %v (%v)", typed, err)
+	}
+}
+
+/**
+	Layouts given by -layout are tried before the default ones, an empty one clears them.
+*/
+func TestLayouts(t *testing.T) {
+	defer layouts.Set("")
+	if _, err := ParseTimestamp("2023.10.11 22:14"); err == nil {
+		t.Errorf("read without a layout")
+	}
+	layouts.Set("2006.01.02 15:04")
+	if typed, err := ParseTimestamp("2023.10.11 22:14"); err != nil || typed != "2023-10-11T22:14:00Z" {
+		t.Errorf("with -layout: %v (%v)", typed, err)
+	}
+	layouts.Set("")
+	if _, err := ParseTimestamp("2023.10.11 22:14"); err == nil {
+		t.Errorf("read after the layouts were cleared")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+import ("fmt"; "log"; "os"; "io"; "io/ioutil"; "bufio"; "strings"; "flag"; "encoding/json"; "html/template")
+
+var textPath = flag.String("text", "text.txt", "file with the searched text")
+var patternPath = flag.String("pattern", "pattern.txt", "file with the pattern of KMP, Horspool or BOM")
+var patternsPath = flag.String("patterns", "", "file with patterns of AC, AdAC or SBOM separated by single spaces (used instead of -pattern)")
+var title = flag.String("title", "", "title of the report, e.g. name of the algorithm")
+var window = flag.Int("window", 0, "length of the search window, 0 for the shortest pattern (use 1 for AC and AdAC)")
+var output = flag.String("o", "", "file to write the report to, stdout if empty")
+
+/**
+	Renders JSON trace of any of the algorithms (traceMode "json") as a single HTML file,
+	which steps through the run forwards and backwards and needs nothing else to be opened.
+
+	Trace is read from files given as command line arguments, or stdin if there is none, e.g.
+	go run sbom.go 2> trace.json; go run ../animate.go -text text.txt -patterns patterns.txt -title SBOM trace.json > sbom.html
+*/
+func main() {
+	flag.Parse()
+	var input io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		readers := make([]io.Reader, 0, flag.NArg())
+		for _, path := range flag.Args() {
+			file, err := os.Open(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			readers = append(readers, file)
+		}
+		input = io.MultiReader(readers...)
+	}
+	textFile, err := ioutil.ReadFile(*textPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var patterns []string
+	if *patternsPath != "" {
+		patFile, err := ioutil.ReadFile(*patternsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		patterns = strings.Split(string(patFile), " ")
+	} else {
+		patFile, err := ioutil.ReadFile(*patternPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		patterns = []string{string(patFile)}
+	}
+	events, err := parseTrace(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(events) == 0 {
+		log.Fatal("No events found in the trace, was traceMode \"json\"?")
+	}
+	r := newRun(string(textFile), patterns, *window, events)
+	r.Title = *title
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := writeHTML(w, r); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	One line of the JSON trace, fields not used by the event are zero.
+*/
+type event struct {
+	Event string `json:"event"`
+	State, From, To, Pos, Shift, Next, Pattern int
+	Char uint8 `json:"char"`
+}
+
+/**
+	Reads the JSON trace, one event per line. Other lines (e.g. output of the program) are skipped.
+*/
+func parseTrace(input io.Reader) (events []event, err error) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{\"event\"") {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("wrong event %q: %v", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+/**
+	Everything the report shows, text and patterns are bytes (they do not have to be UTF-8).
+
+	@field 'Transitions' transitions {from, char, to} in the order they were added
+	@field 'Matches' occurences {pattern, pos} in the order they were found
+	@field 'Steps' one step for each event
+*/
+type run struct {
+	Title string
+	Text []int
+	Patterns [][]int
+	Window int
+	Transitions [][3]int
+	Matches [][2]int
+	Steps []step
+}
+
+/**
+	State of the run after one event. Counts ('States', 'Transitions', 'Matches') say how many
+	of them were there, so that stepping backwards needs no undo.
+
+	@field 'Start' start of the search window, 'Shift' length of its last move
+	@field 'Pos' compared position of the text, -1 if none
+	@field 'State', 'Next' highlighted states of the automaton (transition between them), -1 if none
+*/
+type step struct {
+	Phase, Description string
+	Start, Shift, Pos, State, Next int
+	States, Transitions, Matches, Comparisons, Shifted int
+}
+
+/**
+	Replays 'events' and returns the run with a step for each of them.
+	@param window length of the window, 0 for the shortest non-empty pattern
+*/
+func newRun(text string, patterns []string, window int, events []event) *run {
+	r := &run{Text: bytesOf(text), Window: window}
+	for _, p := range patterns {
+		r.Patterns = append(r.Patterns, bytesOf(p))
+		if window == 0 && len(p) > 0 && (r.Window == 0 || len(p) < r.Window) {
+			r.Window = len(p)
+		}
+	}
+	current := step{Phase: "build", Pos: -1, State: -1, Next: -1}
+	for _, e := range events {
+		current.Pos, current.State, current.Next = -1, -1, -1
+		switch e.Event {
+		case "stateCreated":
+			current.States++
+			current.State = e.State
+			current.Description = fmt.Sprintf("created state %d", e.State)
+		case "transitionAdded":
+			r.Transitions = append(r.Transitions, [3]int{e.From, int(e.Char), e.To})
+			current.Transitions++
+			current.State, current.Next = e.From, e.To
+			current.Description = fmt.Sprintf("added transition σ(%d,%s)=%d", e.From, charLabel(e.Char), e.To)
+		case "windowMoved":
+			current.Phase = "search"
+			current.Start, current.Shift = e.Pos, e.Shift
+			current.Shifted += e.Shift
+			current.Description = fmt.Sprintf("window moved by %d to position %d", e.Shift, e.Pos)
+		case "compared":
+			current.Phase = "search"
+			current.Comparisons++
+			current.Pos, current.State, current.Next = e.Pos, e.State, e.Next
+			if e.Next == -1 {
+				current.Description = fmt.Sprintf("read %s at position %d in state %d: no transition", charLabel(e.Char), e.Pos, e.State)
+			} else {
+				current.Description = fmt.Sprintf("read %s at position %d in state %d, going to state %d", charLabel(e.Char), e.Pos, e.State, e.Next)
+			}
+		case "matchFound":
+			current.Phase = "search"
+			r.Matches = append(r.Matches, [2]int{e.Pattern, e.Pos})
+			current.Matches++
+			current.Description = fmt.Sprintf("occurence of pattern %d at position %d", e.Pattern, e.Pos)
+		default:
+			current.Description = "unknown event "+e.Event
+		}
+		r.Steps = append(r.Steps, current)
+	}
+	return r
+}
+
+func bytesOf(s string) []int {
+	b := make([]int, len(s))
+	for i := 0; i < len(s); i++ {
+		b[i] = int(s[i])
+	}
+	return b
+}
+
+/**
+	Printable ASCII characters are quoted, the others written in hex.
+*/
+func charLabel(c uint8) string {
+	if c > ' ' && c < 127 {
+		return fmt.Sprintf("'%c'", c)
+	}
+	return fmt.Sprintf("0x%02x", c)
+}
+
+/**
+	Writes the report, data of the run are embedded as JSON (json.Marshal escapes '<', '>' and '&',
+	so they are safe inside the script element) and the title is escaped by html/template.
+*/
+func writeHTML(w io.Writer, r *run) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	title := r.Title
+	if title == "" {
+		title = "String matching"
+	}
+	return report.Execute(w, struct{ Title string; Data template.JS }{title, template.JS(data)})
+}
+
+var report = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.text, .pattern { font-family: monospace; font-size: 1.4em; white-space: pre; }
+.text span, .pattern span { display: inline-block; width: 1.1em; text-align: center; }
+.window { background: #ffe9a8; }
+.match { background: #a8e6a8; }
+.fail { background: #f3a6a6; }
+.found { text-decoration: underline; font-weight: bold; }
+.controls button { font-size: 1.1em; margin-right: 0.3em; }
+#slider { width: 40em; }
+table { border-collapse: collapse; margin-top: 1em; font-family: monospace; }
+td, th { border: 1px solid #bbb; padding: 0.15em 0.5em; text-align: left; }
+tr.current td { background: #ffe9a8; }
+span.taken { background: #f0a030; font-weight: bold; }
+.counters span { margin-right: 2em; }
+</style>
+</head>
+<body>
+<h1 id="title"></h1>
+<div class="controls">
+<button onclick="go(0)">&#x23EE;</button>
+<button onclick="go(current-1)">&#x25C0; previous</button>
+<button onclick="go(current+1)">next &#x25B6;</button>
+<button onclick="go(steps.length-1)">&#x23ED;</button>
+<button onclick="go(firstSearch)">search</button>
+<input id="slider" type="range" min="0" value="0" oninput="go(+this.value)">
+</div>
+<p><b id="counter"></b> <span id="phase"></span>: <span id="description"></span></p>
+<p class="counters">
+<span>window at <b id="start"></b></span>
+<span>last shift <b id="shift"></b></span>
+<span>comparisons <b id="comparisons"></b></span>
+<span>shifted <b id="shifted"></b></span>
+<span>occurences <b id="matches"></b></span>
+</p>
+<div class="text" id="text"></div>
+<div id="patterns"></div>
+<table id="automaton"></table>
+<script>
+var run = {{.Data}};
+var steps = run.Steps, current = 0, firstSearch = 0;
+var shownPatterns = 20, context = 30;
+while (firstSearch < steps.length-1 && steps[firstSearch].Phase != "search") firstSearch++;
+
+function show(c) {
+	if (c == 32) return "␣";
+	if (c > 32 && c < 127) return String.fromCharCode(c);
+	return "·";
+}
+
+function cell(c, cls, title) {
+	var s = document.createElement("span");
+	s.textContent = show(c);
+	if (cls) s.className = cls;
+	if (title) s.title = title;
+	return s;
+}
+
+function go(i) {
+	current = Math.max(0, Math.min(steps.length-1, i));
+	var st = steps[current];
+	document.getElementById("slider").value = current;
+	document.getElementById("counter").textContent = "Step " + (current+1) + " of " + steps.length;
+	document.getElementById("phase").textContent = st.Phase;
+	document.getElementById("description").textContent = st.Description;
+	document.getElementById("start").textContent = st.Start;
+	document.getElementById("shift").textContent = st.Shift;
+	document.getElementById("comparisons").textContent = st.Comparisons;
+	document.getElementById("shifted").textContent = st.Shifted;
+	document.getElementById("matches").textContent = st.Matches;
+
+	var from = Math.max(0, st.Start-context), to = Math.min(run.Text.length, st.Start+run.Window+2*context);
+	var found = {};
+	for (var m = 0; m < st.Matches; m++) {
+		var p = run.Patterns[run.Matches[m][0]];
+		for (var k = 0; p && k < p.length; k++) found[run.Matches[m][1]+k] = true;
+	}
+	var text = document.getElementById("text");
+	text.textContent = "";
+	for (var k = from; k < to; k++) {
+		var cls = [];
+		if (st.Phase == "search" && k >= st.Start && k < st.Start+run.Window) cls.push("window");
+		if (k == st.Pos) cls.push(st.Next == -1 ? "fail" : "match");
+		if (found[k]) cls.push("found");
+		text.appendChild(cell(run.Text[k], cls.join(" "), "position " + k));
+	}
+	var patterns = document.getElementById("patterns");
+	patterns.textContent = "";
+	for (var n = 0; n < run.Patterns.length && n < shownPatterns; n++) {
+		var row = document.createElement("div");
+		row.className = "pattern";
+		row.title = "pattern " + n;
+		if (st.Phase == "search") {
+			for (var k = from; k < st.Start; k++) row.appendChild(cell(32, "", ""));
+			for (var k = 0; k < run.Patterns[n].length && st.Start+k < to; k++) {
+				var cls = st.Start+k == st.Pos ? (st.Next == -1 ? "fail" : "match") : "";
+				row.appendChild(cell(run.Patterns[n][k], cls, ""));
+			}
+		}
+		patterns.appendChild(row);
+	}
+	if (run.Patterns.length > shownPatterns) {
+		var more = document.createElement("div");
+		more.textContent = "... and " + (run.Patterns.length-shownPatterns) + " more patterns";
+		patterns.appendChild(more);
+	}
+
+	var table = document.getElementById("automaton");
+	table.textContent = "";
+	if (st.States == 0) return;
+	var rows = [];
+	for (var s = 0; s < st.States; s++) rows.push([]);
+	for (var t = 0; t < st.Transitions; t++) {
+		var tr = run.Transitions[t];
+		if (rows[tr[0]]) rows[tr[0]].push(tr);
+	}
+	var head = document.createElement("tr");
+	head.innerHTML = "<th>state</th><th>transitions</th>";
+	table.appendChild(head);
+	for (var s = 0; s < rows.length; s++) {
+		var row = document.createElement("tr");
+		if (s == st.State) row.className = "current";
+		var name = document.createElement("td");
+		name.textContent = s;
+		var list = document.createElement("td");
+		for (var t = 0; t < rows[s].length; t++) {
+			var tr = rows[s][t], span = document.createElement("span");
+			span.textContent = show(tr[1]) + "→" + tr[2] + " ";
+			if (tr[0] == st.State && tr[2] == st.Next && (st.Pos == -1 || run.Text[st.Pos] == tr[1])) span.className = "taken";
+			list.appendChild(span);
+		}
+		row.appendChild(name);
+		row.appendChild(list);
+		table.appendChild(row);
+	}
+}
+
+document.getElementById("title").textContent = document.title;
+document.getElementById("slider").max = steps.length-1;
+document.addEventListener("keydown", function(e) {
+	if (e.key == "ArrowRight") go(current+1);
+	if (e.key == "ArrowLeft") go(current-1);
+	if (e.key == "Home") go(0);
+	if (e.key == "End") go(steps.length-1);
+});
+go(0);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,64 @@
+package main
+import ("testing"; "strings"; "bytes")
+
+/**
+	Run with: go test animate.go animate_test.go
+	Trace of BOM searching for "ab" in "abab" is replayed step by step.
+*/
+func TestNewRun(t *testing.T) {
+	trace := `
+Running: Backward Oracle Matching alghoritm.
+{"event":"stateCreated","state":0}
+{"event":"stateCreated","state":1}
+{"event":"transitionAdded","from":0,"char":98,"to":1}
+{"event":"stateCreated","state":2}
+{"event":"transitionAdded","from":1,"char":97,"to":2}
+{"event":"transitionAdded","from":0,"char":97,"to":2}
+{"event":"compared","pos":1,"char":98,"state":0,"next":1}
+{"event":"compared","pos":0,"char":97,"state":1,"next":2}
+{"event":"matchFound","pattern":0,"pos":0}
+{"event":"windowMoved","pos":1,"shift":1}
+{"event":"compared","pos":2,"char":97,"state":0,"next":2}
+{"event":"compared","pos":1,"char":98,"state":2,"next":-1}
+{"event":"windowMoved","pos":2,"shift":1}
+`
+	events, err := parseTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRun("abab", []string{"ab"}, 0, events)
+	if len(r.Steps) != 13 || r.Window != 2 || len(r.Transitions) != 3 || len(r.Matches) != 1 {
+		t.Fatalf("wrong run %+v", r)
+	}
+	last := r.Steps[len(r.Steps)-1]
+	expected := step{Phase: "search", Description: "window moved by 1 to position 2", Start: 2, Shift: 1, Pos: -1, State: -1, Next: -1,
+		States: 3, Transitions: 3, Matches: 1, Comparisons: 4, Shifted: 2}
+	if last != expected {
+		t.Errorf("last step %+v, expected %+v", last, expected)
+	}
+	if failed := r.Steps[11]; failed.Pos != 1 || failed.State != 2 || failed.Next != -1 || failed.Phase != "search" {
+		t.Errorf("wrong failed comparison %+v", failed)
+	}
+	if _, err := parseTrace(strings.NewReader(`{"event":"compared","pos":"x"}`)); err == nil {
+		t.Errorf("wrong event accepted")
+	}
+}
+
+/**
+	Report embeds the run and escapes the title and texts with "</script>".
+*/
+func TestWriteHTML(t *testing.T) {
+	r := newRun("</script>", []string{"<"}, 0, []event{{Event: "compared", Pos: 0, Char: '<', Next: 1}})
+	r.Title = "<b>BOM</b>"
+	var output bytes.Buffer
+	if err := writeHTML(&output, r); err != nil {
+		t.Fatal(err)
+	}
+	html := output.String()
+	if strings.Contains(html, "<b>BOM") || !strings.Contains(html, "&lt;b&gt;BOM") {
+		t.Errorf("title is not escaped")
+	}
+	if strings.Count(html, "</script>") != 1 || !strings.Contains(html, `"Text":[60,47,115`) {
+		t.Errorf("run is not embedded safely")
+	}
+}
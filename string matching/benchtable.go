@@ -0,0 +1,150 @@
+package main
+import ("fmt"; "log"; "os"; "io"; "bufio"; "strings"; "strconv"; "text/tabwriter")
+
+/**
+	Renders output of the benchmarks (go test -bench) as tables comparing the algorithms.
+	Reads files given as command line arguments, or stdin if there is none.
+
+	Benchmark names have to be "Benchmark<Algorithm>/<corpus>/<phase>", phase is "build" or "search".
+	More runs of one benchmark (-count) are averaged.
+*/
+func main() {
+	var input io.Reader = os.Stdin
+	if len(os.Args) > 1 {
+		readers := make([]io.Reader, 0, len(os.Args)-1)
+		for _, path := range os.Args[1:] {
+			file, err := os.Open(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			readers = append(readers, file)
+		}
+		input = io.MultiReader(readers...)
+	}
+	results, err := parseBenchmarks(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(results.algorithms) == 0 {
+		log.Fatal("No benchmarks found in the input!")
+	}
+	for _, line := range results.header {
+		fmt.Println(line)
+	}
+	writeTable(os.Stdout, "Search (ns/byte, lower is better)", results, "search", "ns/byte")
+	writeTable(os.Stdout, "Search (allocs/op)", results, "search", "allocs/op")
+	writeTable(os.Stdout, "Build (ns/op)", results, "build", "ns/op")
+	writeTable(os.Stdout, "Build (allocs/op)", results, "build", "allocs/op")
+}
+
+/**
+	Parsed benchmarks, algorithms and corpora are kept in order of their first appearance.
+
+	@field 'header' lines describing the machine (goos, goarch, cpu), each one only once
+	@field 'metrics' sum of each metric of algorithm/corpus/phase, key "Algorithm/corpus/phase/unit"
+	@field 'runs' number of runs summed in 'metrics', key "Algorithm/corpus/phase"
+*/
+type benchmarks struct {
+	header []string
+	algorithms []string
+	corpora []string
+	metrics map[string]float64
+	runs map[string]int
+}
+
+/**
+	Reads lines like "BenchmarkKnp/dna/search-8  1000  1234 ns/op  2.5 ns/byte  0 allocs/op",
+	other lines are skipped.
+*/
+func parseBenchmarks(input io.Reader) (*benchmarks, error) {
+	results := &benchmarks{metrics: make(map[string]float64), runs: make(map[string]int)}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "goos:") || strings.HasPrefix(line, "goarch:") || strings.HasPrefix(line, "cpu:") {
+			if !containsString(results.header, line) {
+				results.header = append(results.header, line)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := strings.SplitN(strings.TrimPrefix(fields[0], "Benchmark"), "/", 3)
+		if len(name) != 3 {
+			continue
+		}
+		if dash := strings.LastIndexByte(name[2], '-'); dash >= 0 { //GOMAXPROCS suffix
+			name[2] = name[2][:dash]
+		}
+		algorithm, corpus, phase := name[0], name[1], name[2]
+		if !containsString(results.algorithms, algorithm) {
+			results.algorithms = append(results.algorithms, algorithm)
+		}
+		if !containsString(results.corpora, corpus) {
+			results.corpora = append(results.corpora, corpus)
+		}
+		key := algorithm+"/"+corpus+"/"+phase
+		results.runs[key]++
+		for i := 2; i+1 < len(fields); i += 2 { //fields[1] is number of iterations
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("wrong value %q in line %q", fields[i], line)
+			}
+			results.metrics[key+"/"+fields[i+1]] += value
+		}
+	}
+	return results, scanner.Err()
+}
+
+/**
+	Writes one table, a row for each corpus and a column for each algorithm,
+	with average 'unit' measured in 'phase'. Missing results are written as "-".
+*/
+func writeTable(output io.Writer, title string, results *benchmarks, phase, unit string) {
+	fmt.Fprintf(output, "\n%s\n", title)
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "corpus\t%s\t\n", strings.Join(results.algorithms, "\t"))
+	for _, corpus := range results.corpora {
+		row := corpus+"\t"
+		for _, algorithm := range results.algorithms {
+			key := algorithm+"/"+corpus+"/"+phase
+			sum, ok := results.metrics[key+"/"+unit]
+			if !ok {
+				row = row+"-\t"
+				continue
+			}
+			row = row+formatValue(sum/float64(results.runs[key]))+"\t"
+		}
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+}
+
+/**
+	Formats a value with three significant digits (whole numbers as they are), without exponent.
+*/
+func formatValue(v float64) string {
+	switch {
+	case v >= 100 || v == float64(int64(v)):
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	case v >= 10:
+		return strconv.FormatFloat(v, 'f', 1, 64)
+	default:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+}
+
+/**
+	Returns 'true' if array of strings 's' contains string 'e', 'false' otherwise.
+*/
+func containsString(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
@@ -1,13 +1,63 @@
 ﻿package main
-import ("fmt"; "log"; "os"; "io/ioutil"; "time")
+import ("fmt"; "log"; "os"; "io"; "io/ioutil"; "time"; "stringmatching/matching")
 
 /** 
 	User defined.
 	
-	@true prints various extra stuff out, but slows down the bom execution
-	@false will be quick and quiet
+	@"text" prints various extra stuff out (to stderr), but slows down the bom execution
+	@"json" prints the same events as JSON, one per line (to stderr)
+	@"" will be quick and quiet
 */
-const debugMode bool = false
+const traceMode string = ""
+
+/**
+	Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+	User defined.
+
+	@"dot" writes the oracle to automaton.dot (Graphviz)
+	@"mermaid" writes it to automaton.mmd (Mermaid flowchart)
+	@"" exports nothing
+*/
+const exportFormat string = ""
+
+/**
+	User defined.
+
+	@true highlights transitions taken while searching in the text in the export
+	@false exports the oracle only
+*/
+const exportSearchPath bool = true
+
+/**
+	User defined.
+
+	@"" builds the oracle on every run
+	@"file name" loads the compiled oracle from the file, or builds it and saves it there
+	if the file does not exist yet or was built for other pattern
+*/
+const automatonFile string = ""
+
+/**
+	User defined.
+
+	@"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+	@"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+	User defined.
+
+	@1 searches the text sequentially
+	@n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+	@0 uses a goroutine for every CPU core
+	The search is sequential while tracing.
+*/
+const workers int = 1
 const commandLineInput bool = false
 
 /**
@@ -36,95 +86,170 @@ func main() {
 		if ( len(args[1]) > len(s) ) {
 			log.Fatal("Pattern  is longer than text!")
 		} 
-		if(debugMode==true) {
+		setTracer(s)
+		if(trace != nil) {
 			fmt.Printf("\nRunning: Backward Oracle Matching algorithm.\n\n")
 			fmt.Printf("Search word (%d chars long): %q.\n",len(args[1]), pattern)
 			fmt.Printf("Text        (%d chars long): %q.\n\n",len(s), s)
 		} else {
 			fmt.Printf("\nRunning: Backward Oracle Matching algorithm.\n\n")
 		}
-		bom(s, pattern)
+		printResult(pattern, matching.TextInput(s))
+		export(s, pattern)
 	} else if (commandLineInput == false) { //in case of file line input
 		patFile, err := ioutil.ReadFile("pattern.txt")
 		if err != nil {
 			log.Fatal(err)
 		}
-		textFile, err := ioutil.ReadFile("text.txt")
+		in, err := matching.OpenInput(inputFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if (len(patFile) > len(textFile)) {
+		defer in.Close()
+		if (traceMode != "" || exportFormat != "") { //both show the text, so a streamed one is read whole
+			if err := in.ReadAll(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if (in.Whole() && len(patFile) > len(in.Text)) {
 			log.Fatal("Pattern  is longer than text!")
 		}
-		if(debugMode==true) {
+		setTracer(in.Text)
+		if(trace != nil) {
 			fmt.Printf("\nRunning: Backward Oracle Matching alghoritm.\n\n")
 			fmt.Printf("Search word (%d chars long): %q.\n",len(patFile), patFile)
-			fmt.Printf("Text        (%d chars long): %q.\n\n",len(textFile), textFile)
+			fmt.Printf("Text        (%s): %s.\n\n", in.Length(), in.Preview())
 		} else {
 			fmt.Printf("\nRunning: Backward Oracle Matching alghoritm.\n\n")
 		}
-		bom(string(textFile), string(patFile))
+		printResult(string(patFile), in)
+		export(in.Text, string(patFile))
 	}
 }
 
+/**
+	Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+	var err error
+	if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Exports factor oracle of reversed 'p' according to exportFormat,
+	with transitions taken while searching in 't' if exportSearchPath is set.
+*/
+func export(t, p string) {
+	if (exportFormat == "" || len(p) == 0) {
+		return
+	}
+	previous := trace
+	trace = nil //construction was already traced by the search
+	oracle := oracleOnLine(reverse(p))
+	g := matching.NewGraph(fmt.Sprintf("Factor oracle of reversed %q", p), oracle)
+	g.Final[len(p)] = true
+	if (exportSearchPath == true) {
+		path := matching.NewSearchPath()
+		trace = path
+		bomSearch(t, p, oracle, nil)
+		g.Highlight(path)
+	}
+	trace = previous
+	if err := matching.ExportGraph(g, exportFormat); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Runs bom and prints how long it took and positions of all occurences
+	of the word/pattern 'p' in text 't' or that the word was not found, and statistics of the search.
+*/
+func printResult(p string, in *matching.Input) {
+	startTime := time.Now()
+	st := &matching.Stats{}
+	occurences := runBom(in, p, st)
+	elapsed := time.Since(startTime)
+	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
+	fmt.Printf("\n\n")
+	if (len(occurences) > 0) {
+		fmt.Printf("Word %q was found %d times at positions: ", p, len(occurences))
+		for k := 0; k<len(occurences)-1; k++ {
+			fmt.Printf("%d, ",occurences[k])
+		}
+		fmt.Printf("%d",occurences[len(occurences)-1])
+		fmt.Printf(".\n")
+	}
+	if(len(occurences) == 0) {
+		fmt.Printf("\nWord was not found.\n")
+	}
+	fmt.Printf("%s", st)
+}
+
 /**
 	Function bom performing the Backward Oracle Matching alghoritm.
-    Prints whether the word/pattern was found + positions of possible multiple occurences
-	or that the word was not found.
+    Returns positions of all occurences of the word/pattern (none for an empty word).
 	
 	@param t string/text to be searched in
 	@param p pattern/word to be serached for
+	@param st statistics to be filled, nil if not wanted
+	@return occurences positions in text, in increasing order
 */  
-func bom(t, p string) {
-	startTime := time.Now()
+func bom(t, p string, st *matching.Stats) (occurences []int) {
+	if (len(p) == 0) {
+		return nil
+	}
+	if (st == nil) {
+		return bomSearch(t, p, oracleOnLine(reverse(p)), nil)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	oracle := oracleOnLine(reverse(p))
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(oracle), countTransitions(oracle)
+	start = time.Now()
+	occurences = bomSearch(t, p, oracle, st)
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Searching part of bom, 'oracle' is built by oracleOnLine for reversed non-empty 'p'.
+	Counts comparisons (characters read in the oracle) and shifts into 'st' unless it is nil.
+*/
+func bomSearch(t, p string, oracle map[int]map[uint8]int, st *matching.Stats) (occurences []int) {
 	n, m := len(t), len(p)
 	var current, j, pos int
-	oracle := oracleOnLine(reverse(p))
-	occurences := make([]int, len(t))
-	currentOcc := 0
 	pos = 0
-	if(debugMode==true) {
-		fmt.Printf("\n\nWe are reading backwards in %q, searching for %q\n\nat position %d:\n",t, p, pos+m-1)
-	}
 	for (pos <= n - m) {
 		current = 0 //initial state of the oracle
 		j = m
 		for j > 0 && stateExists(current, oracle) {
-			if(debugMode==true) {
-				prettyPrint(current, j, n, pos, t, oracle)
+			if(trace != nil) {
+				trace.Compared(pos+j-1, t[pos+j-1], current, getTransition(current, t[pos+j-1], oracle))
 			}
 			current = getTransition(current, t[pos+j-1], oracle)
 			j--
+			if (st != nil) {
+				st.Comparisons++
+			}
 		}
 		if stateExists(current, oracle){
-			if(debugMode==true) {
-				fmt.Printf(" We got an occurence!")
+			occurences = append(occurences, pos)
+			if(trace != nil) {
+				trace.MatchFound(0, pos)
 			}
-			occurences[currentOcc] = pos
-			currentOcc++
 		}
 		pos = pos + j +1
-		if (pos+m-1 < len(t)) {
-			if(debugMode==true) {
-				fmt.Printf("\n\nposition %d:\n",pos+m-1)
-			}
+		if (st != nil) {
+			st.Shifts++
+			st.Shifted += j + 1
 		}
-	}
-	elapsed := time.Since(startTime)
-	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
-	fmt.Printf("\n\n")
-	if (currentOcc > 0) {
-		fmt.Printf("Word %q was found %d times at positions: ", p, currentOcc)
-		for k := 0; k<currentOcc-1; k++ {
-			fmt.Printf("%d, ",occurences[k])
+		if(trace != nil) {
+			trace.WindowMoved(pos, j + 1)
 		}
-		fmt.Printf("%d",occurences[currentOcc-1])
-		fmt.Printf(".\n")
-	}
-	if(currentOcc == 0) {
-		fmt.Printf("\nWord was not found.\n")
 	}
-	return
+	return occurences
 }
 
 /**
@@ -135,9 +260,6 @@ func bom(t, p string) {
 	@return oracle built oracle
 */
 func oracleOnLine(p string)(oracle map[int]map[uint8]int) {
-	if(debugMode==true) {
-		fmt.Printf("Oracle construction: \n")
-	}
 	oracle = make(map[int]map[uint8]int)
 	supply := make([]int, len(p)+2) //supply function
 	createNewState(0, oracle)
@@ -173,19 +295,19 @@ func oracleAddLetter(oracle map[int]map[uint8]int, supply []int, orP string, o u
 		s = getTransition(k,o, oracle)
 	}
 	supply[m+1] = s
-	return oracle, orP+string(o)
+	return oracle, orP+string([]uint8{o}) //one byte, string(o) would encode o as UTF-8
 }
 
 /**	
-	Function that takes a single string and reverses it.
-	@author 'Walter' http://stackoverflow.com/a/10043083
+	Function that takes a single string and reverses it byte by byte
+	(the automaton works on bytes, so this holds for any text, not only UTF-8).
 */
 func reverse(s string) string {
     l := len(s)
-    m := make([]rune, l)
-    for _, c := range s {
+    m := make([]uint8, l)
+    for i := 0; i < len(s); i++ {
         l--
-        m[l] = c
+        m[l] = s[i]
     }
     return string(m)
 }
@@ -198,8 +320,8 @@ func reverse(s string) string {
 */
 func createNewState(state int, at map[int]map[uint8]int) {
 	at[state] = make(map[uint8]int)
-	if debugMode==true {
-		fmt.Printf("\ncreated state %d", state)
+	if trace != nil {
+		trace.StateCreated(state)
 	}
 }
 
@@ -209,8 +331,8 @@ func createNewState(state int, at map[int]map[uint8]int) {
 */
 func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
 	at[fromState][overChar]= toState
-	if debugMode==true {
-		fmt.Printf("\n    σ(%d,%c)=%d;",fromState,overChar,toState)
+	if trace != nil {
+		trace.TransitionAdded(fromState, overChar, toState)
 	}
 }
 
@@ -242,31 +364,109 @@ func stateExists(state int, at map[int]map[uint8]int)bool {
 }
 
 /**
-	Just some printing of what the alghoritm does.
+	Counts transitions of automaton 'at'.
+	@param 'at' automaton
 */
-func prettyPrint(current int, j int, n int, pos int, t string, oracle map[int]map[uint8]int) {
-	if (current == 0 && !(getTransition(current, t[pos+j-1], oracle) == -1)) {
-		fmt.Printf("\n -->(%d)---(%c)--->(%d)", current, t[pos+j-1], getTransition(current, t[pos+j-1], oracle))
-	} else if (getTransition(current, t[pos+j-1], oracle) == -1 && current !=0) {
-		fmt.Printf("\n    (%d)---(%c)       ", current, t[pos+j-1])
-	} else if (getTransition(current, t[pos+j-1], oracle) == -1 && current ==0) {
-		fmt.Printf("\n -->(%d)---(%c)       ", current, t[pos+j-1])
-	} else {
-		fmt.Printf("\n    (%d)---(%c)--->(%d)", current, t[pos+j-1], getTransition(current, t[pos+j-1], oracle))
+func countTransitions(at map[int]map[uint8]int) (transitions int) {
+	for _, t := range at {
+		transitions += len(t)
 	}
-	fmt.Printf(" ")
-	for a := 0; a < pos+j-1; a++ {
-		fmt.Printf("%c", t[a])
+	return transitions
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+	Runs bom, with the oracle loaded from automatonFile if it is set (loading is measured as building),
+	searching in chunks on several goroutines according to workers.
+	A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runBom(in *matching.Input, p string, st *matching.Stats) []int {
+	n := matching.Workers(workers, trace != nil)
+	if ((in.Whole() && automatonFile == "" && n == 1) || len(p) == 0) {
+		return bom(in.Text, p, st)
 	}
-	if (getTransition(current, t[pos+j-1], oracle) == -1) {
-		fmt.Printf("[%c]", t[pos+j-1])
-	} else {
-		fmt.Printf("[%c]", t[pos+j-1])
+	start, memory := time.Now(), matching.AllocatedBytes()
+	c, err := loadOrCompile(automatonFile, p)
+	if err != nil {
+		log.Fatal(err)
 	}
-	for a := pos+j; a<n; a++ {
-			fmt.Printf("%c", t[a])
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(c.oracle), countTransitions(c.oracle)
+	start = time.Now()
+	occurences, err := in.Search(c.overlap(), n, st, matching.Single(c.search))
+	if err != nil {
+		log.Fatal(err)
 	}
-	if (getTransition(current, t[pos+j-1], oracle) == -1) {
-		fmt.Printf(" FAIL on the character[%c]", t[pos+j-1])
-	}	
-}
\ No newline at end of file
+	st.Search = time.Since(start)
+	return occurences[0]
+}
+
+/**
+	Pattern with factor oracle of its reverse, ready to be saved and searched with.
+*/
+type compiled struct {
+	pattern string
+	oracle map[int]map[uint8]int
+}
+
+/**
+	Compiles non-empty 'p'.
+*/
+func compile(p string) *compiled {
+	return &compiled{p, oracleOnLine(reverse(p))}
+}
+
+/**
+	Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) search(text string, st *matching.Stats) []int {
+	return bomSearch(text, c.pattern, c.oracle, st)
+}
+
+/**
+	Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) overlap() int {
+	return len(c.pattern) - 1
+}
+
+const algorithmBom = 3
+
+/**
+	Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+	e := &matching.Encoder{}
+	e.Text(c.pattern)
+	e.Automaton(c.oracle)
+	return e.Save(w, algorithmBom)
+}
+
+/**
+	Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+	d, err := matching.Load(r, algorithmBom)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{pattern: d.Text()}
+	c.oracle = d.Automaton()
+	if d.Err == nil && (len(c.pattern) == 0 || len(c.oracle) != len(c.pattern)+1) {
+		d.Fail("oracle of %d states for a pattern of length %d", len(c.oracle), len(c.pattern))
+	}
+	if err := d.End(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+	Loads matcher for 'p' from file 'path', or compiles it and saves it there
+	if the file does not exist or holds a matcher of another pattern.
+	Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path, p string) (*compiled, error) {
+	return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(p) },
+		func(c *compiled) bool { return c.pattern == p })
+}
@@ -0,0 +1,95 @@
+package main
+import ("testing"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	BOM as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "bom",
+	Search: func(text string, p []string, st *matching.Stats) map[int][]int {
+		return matchingtest.Found(bom(text, p[0], st))
+	},
+	Trace: &trace,
+	Comparisons: true,
+	States: true,
+	Algorithm: algorithmBom,
+	Compile: func(p []string) *compiled { return compile(p[0]) },
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: func(path string, p []string) (*compiled, error) { return loadOrCompile(path, p[0]) },
+	Compiled: func(c *compiled) matching.Search { return matchingtest.Single(c.search) },
+	Overlap: (*compiled).overlap,
+	Patterns: func(c *compiled) []string { return []string{c.pattern} },
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzBom bom.go bom_test.go
+	Inputs that failed are saved in testdata/fuzz/FuzzBom and checked by every go test.
+*/
+func FuzzBom(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	defer func() { trace = nil }()
+	p := "abab"
+	oracle := oracleOnLine(reverse(p))
+	g, path := matching.NewGraph("oracle", oracle), matching.NewSearchPath()
+	g.Final[len(p)] = true
+	trace = path
+	bomSearch("abaabab", p, oracle, nil)
+	trace = nil
+	g.Highlight(path)
+	matchingtest.CheckGraph(t, g, "4 [label=\"4\", shape=doublecircle];")
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled bom.go bom_test.go
+	BOM does not verify occurences, it trusts the oracle (the checksum guards it against damage),
+	so unlike SBOM a made up oracle may find something else than the pattern.
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -run XXX -bench . bom.go bom_test.go
+	Building the oracle and searching for the first pattern of each corpus are measured separately.
+*/
+func BenchmarkBom(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, "multiple string matching", func(text string, p []string) func() {
+		oracle := oracleOnLine(reverse(p[0]))
+		return func() { bomSearch(text, p[0], oracle, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
@@ -0,0 +1,3 @@
+module stringmatching
+
+go 1.22
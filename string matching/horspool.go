@@ -1,8 +1,49 @@
 ﻿package main
-import ("fmt"; "log"; "os"; "io/ioutil")
+import ("fmt"; "log"; "os"; "io"; "io/ioutil"; "time"; "sort"; "stringmatching/matching")
 
 const commandLineInput bool = false
 
+/**
+	User defined.
+
+	@"text" prints shifts and every comparison of characters (to stderr)
+	@"json" prints the same events as JSON, one per line (to stderr)
+	@"" prints only the result
+*/
+const traceMode string = "text"
+
+/**
+	Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+	User defined.
+
+	@"" builds the shift table on every run
+	@"file name" loads the compiled shift table from the file, or builds it and saves it there
+	if the file does not exist yet or was built for other pattern
+*/
+const automatonFile string = ""
+
+/**
+	User defined.
+
+	@"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+	@"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+	User defined.
+
+	@1 searches the text sequentially
+	@n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+	@0 uses a goroutine for every CPU core
+	The search is sequential while tracing.
+*/
+const workers int = 1
+
 /**
  	Implementation of Boyer-Moore-Horspool algorithm (Sufix based aproach).
 	
@@ -31,64 +72,137 @@ func main() {
 		fmt.Printf("\nRunning: Horspool algorithm.\n\n")
 		fmt.Printf("Search word (%d chars long): %q.\n",len(args[1]), pattern)
 		fmt.Printf("Text        (%d chars long): %q.\n\n",len(s), s)
-		horspool(s, pattern)
+		setTracer(s)
+		st := &matching.Stats{}
+		printResult(pattern, runHorspool(matching.TextInput(s), pattern, st), st)
 	} else if (commandLineInput == false) { //in case of file line input
 		patFile, err := ioutil.ReadFile("pattern.txt")
 		if err != nil {
 			log.Fatal(err)
 		}
-		textFile, err := ioutil.ReadFile("text.txt")
+		in, err := matching.OpenInput(inputFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if (len(patFile) > len(textFile)) {
+		defer in.Close()
+		if (traceMode != "") { //tracing shows the text, so a streamed one is read whole
+			if err := in.ReadAll(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if (in.Whole() && len(patFile) > len(in.Text)) {
 			log.Fatal("Pattern  is longer than text!")
 		}
 		fmt.Printf("\nRunning: Horspool algorithm.\n\n")
 		fmt.Printf("Search word (%d chars long): %q.\n",len(patFile), patFile)
-		fmt.Printf("Text        (%d chars long): %q.\n\n",len(textFile), textFile)
-		horspool(string(textFile), string(patFile))
+		fmt.Printf("Text        (%s): %s.\n\n", in.Length(), in.Preview())
+		setTracer(in.Text)
+		st := &matching.Stats{}
+		printResult(string(patFile), runHorspool(in, string(patFile), st), st)
 	}
 }
 
+/**
+	Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+	var err error
+	if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Prints positions of all occurences of 'word' or that it was not found, and statistics of the search.
+*/
+func printResult(word string, occurences []int, st *matching.Stats) {
+	if (len(occurences) == 0) {
+		fmt.Printf("\n\nWord was not found.\n%s", st)
+		return
+	}
+	fmt.Printf("\n\nWord %q was found %d times at positions: ", word, len(occurences))
+	for k := 0; k<len(occurences)-1; k++ {
+		fmt.Printf("%d, ",occurences[k])
+	}
+	fmt.Printf("%d.\n%s", occurences[len(occurences)-1], st)
+}
+
 /**
 	Function horspool performing the Horspool algorithm
-    Prints whether the word/pattern was found and on what position in the text or not.
+    Returns positions of all occurences of the word/pattern in the text (none for an empty word).
+	The shift is given by the character just behind the search window.
 	
 	@param t string/text to be searched in
 	@param p word/pattern to be serached for
+	@param st statistics to be filled, nil if not wanted
+	@return occurences positions in text, in increasing order
 */  
-func horspool(t, p string) {
-	m, n, c, pos := len(p), len(t), 0, 0
+func horspool(t, p string, st *matching.Stats) (occurences []int) {
+	if (len(p) == 0) {
+		return nil
+	}
 	//Perprocessing
-	d := preprocess(t,p)
-	//Map output
-	fmt.Printf("Precomputed shifts per symbol: ")
-	for key, value := range d {
-		fmt.Printf("%c:%d; ", key, value)
+	if (st == nil) {
+		return horspoolSearch(t, p, preprocess(t,p), nil)
 	}
-	fmt.Println()
+	start, memory := time.Now(), matching.AllocatedBytes()
+	d := preprocess(t,p)
+	st.Build, st.Memory, st.States = time.Since(start), matching.AllocatedBytes() - memory, len(d)
+	start = time.Now()
+	occurences = horspoolSearch(t, p, d, st)
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Searching part of horspool, 'd' are the shifts computed by preprocess for non-empty 'p'.
+	Counts comparisons and shifts into 'st' unless it is nil.
+*/
+func horspoolSearch(t, p string, d map[uint8]int, st *matching.Stats) (occurences []int) {
+	m, n, pos := len(p), len(t), 0
 	//Searching
 	for pos <= n - m {
 		j := m
-		if (t[pos+j-1] != p[j-1]) {
-			fmt.Printf("\n   comparing characters %c %c at positions %d %d",t[pos+j-1],p[j-1], pos+j-1, j-1)
-			c++
-		}
 		for j > 0 && t[pos+j-1] == p[j-1] {
-			fmt.Printf("\n   comparing characters %c %c at positions %d %d",t[pos+j-1],p[j-1], pos+j-1, j-1)
-			c++
-			fmt.Printf(" - match")
+			if (trace != nil) {
+				trace.Compared(pos+j-1, t[pos+j-1], m-j, m-j+1)
+			}
+			if (st != nil) {
+				st.Comparisons++
+			}
 			j--
 		}
+		if (j > 0) { //the characters, which differ
+			if (st != nil) {
+				st.Comparisons++
+			}
+			if (trace != nil) {
+				trace.Compared(pos+j-1, t[pos+j-1], m-j, -1)
+			}
+		}
 		if j==0 {
-				fmt.Printf("\n\nWord %q was found at position %d in %q. \n%d comparisons were done.",p, pos, t, c)
-				return
+			occurences = append(occurences, pos)
+			if (trace != nil) {
+				trace.MatchFound(0, pos)
 			}
-		pos = pos + d[t[pos + m ]]
+		}
+		if (pos + m == n) { //no character behind the window
+			break
+		}
+		shift, ok := d[t[pos + m ]]
+		if (!ok) { //character not in the pattern, e.g. shifts were computed for another text
+			shift = m
+		}
+		pos = pos + shift
+		if (st != nil) {
+			st.Shifts++
+			st.Shifted += shift
+		}
+		if (trace != nil) {
+			trace.WindowMoved(pos, shift)
+		}
 	}
-	fmt.Printf("\n\nWord was not found.\n%d comparisons were done.",c)
-	return
+	return occurences
 }
 
 /**
@@ -105,4 +219,117 @@ func preprocess(t, p string)(d map[uint8]int) {
 		d[p[i]] = len(p)-i
 	}
 	return d
-}
\ No newline at end of file
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+	Runs horspool, with the shifts loaded from automatonFile if it is set (loading is measured as building),
+	searching in chunks on several goroutines according to workers.
+	A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runHorspool(in *matching.Input, p string, st *matching.Stats) []int {
+	n := matching.Workers(workers, trace != nil)
+	if ((in.Whole() && automatonFile == "" && n == 1) || len(p) == 0) {
+		return horspool(in.Text, p, st)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	c, err := loadOrCompile(automatonFile, p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Build, st.Memory, st.States = time.Since(start), matching.AllocatedBytes() - memory, len(c.shifts)
+	start = time.Now()
+	occurences, err := in.Search(c.overlap(), n, st, matching.Single(c.search))
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Search = time.Since(start)
+	return occurences[0]
+}
+
+/**
+	Pattern with shifts of its characters, ready to be saved and searched with.
+	Other characters shift by the whole length of the pattern.
+*/
+type compiled struct {
+	pattern string
+	shifts map[uint8]int
+}
+
+/**
+	Compiles non-empty 'p', shifts do not depend on any text.
+*/
+func compile(p string) *compiled {
+	return &compiled{p, preprocess("", p)}
+}
+
+/**
+	Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) search(text string, st *matching.Stats) []int {
+	return horspoolSearch(text, c.pattern, c.shifts, st)
+}
+
+/**
+	Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) overlap() int {
+	return len(c.pattern) - 1
+}
+
+const algorithmHorspool = 2
+
+/**
+	Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+	e := &matching.Encoder{}
+	e.Text(c.pattern)
+	chars := make([]int, 0, len(c.shifts))
+	for char := range c.shifts {
+		chars = append(chars, int(char))
+	}
+	sort.Ints(chars)
+	e.Uint(len(chars))
+	for _, char := range chars {
+		e.Byte(uint8(char))
+		e.Uint(c.shifts[uint8(char)])
+	}
+	return e.Save(w, algorithmHorspool)
+}
+
+/**
+	Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+	d, err := matching.Load(r, algorithmHorspool)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{pattern: d.Text(), shifts: make(map[uint8]int)}
+	if d.Err == nil && len(c.pattern) == 0 {
+		d.Fail("empty pattern")
+	}
+	n := d.Count()
+	for i := 0; i < n; i++ {
+		char, shift := d.Byte(), d.Uint()
+		if shift < 1 || shift > len(c.pattern) {
+			d.Fail("shift %d of a pattern of length %d", shift, len(c.pattern))
+		}
+		c.shifts[char] = shift
+	}
+	if err := d.End(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+	Loads matcher for 'p' from file 'path', or compiles it and saves it there
+	if the file does not exist or holds a matcher of another pattern.
+	Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path, p string) (*compiled, error) {
+	return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(p) },
+		func(c *compiled) bool { return c.pattern == p })
+}
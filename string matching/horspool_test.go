@@ -0,0 +1,77 @@
+package main
+import ("testing"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	Horspool as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "horspool",
+	Search: func(text string, p []string, st *matching.Stats) map[int][]int {
+		return matchingtest.Found(horspool(text, p[0], st))
+	},
+	Trace: &trace,
+	Comparisons: true,
+	Algorithm: algorithmHorspool,
+	Compile: func(p []string) *compiled { return compile(p[0]) },
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: func(path string, p []string) (*compiled, error) { return loadOrCompile(path, p[0]) },
+	Compiled: func(c *compiled) matching.Search { return matchingtest.Single(c.search) },
+	Overlap: (*compiled).overlap,
+	Patterns: func(c *compiled) []string { return []string{c.pattern} },
+	Verifies: true,
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzHorspool horspool.go horspool_test.go
+	Inputs that failed are saved in testdata/fuzz/FuzzHorspool and checked by every go test.
+*/
+func FuzzHorspool(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled horspool.go horspool_test.go
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -run XXX -bench . horspool.go horspool_test.go
+	Computing the shifts and searching for the first pattern of each corpus are measured separately.
+*/
+func BenchmarkHorspool(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, "multiple string matching", func(text string, p []string) func() {
+		d := preprocess(text, p[0])
+		return func() { horspoolSearch(text, p[0], d, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
@@ -1,5 +1,5 @@
 ﻿package main
-import ("fmt"; "log"; "os"; "io/ioutil") 
+import ("fmt"; "log"; "os"; "io"; "io/ioutil"; "time"; "stringmatching/matching") 
 
 /** 
 	User defined.
@@ -9,6 +9,64 @@ import ("fmt"; "log"; "os"; "io/ioutil")
 */
 const commandLineInput bool = false
 
+/**
+	User defined.
+
+	@"text" prints every comparison of characters (to stderr)
+	@"json" prints the same events as JSON, one per line (to stderr)
+	@"" prints only the result
+*/
+const traceMode string = "text"
+
+/**
+	Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+	User defined.
+
+	@"dot" writes the automaton (table) to automaton.dot (Graphviz)
+	@"mermaid" writes it to automaton.mmd (Mermaid flowchart)
+	@"" exports nothing
+*/
+const exportFormat string = ""
+
+/**
+	User defined.
+
+	@true highlights transitions taken while searching in the text in the export
+	@false exports the automaton (table) only
+*/
+const exportSearchPath bool = true
+
+/**
+	User defined.
+
+	@"" builds the table on every run
+	@"file name" loads the compiled table from the file, or builds it and saves it there
+	if the file does not exist yet or was built for other word
+*/
+const automatonFile string = ""
+
+/**
+	User defined.
+
+	@"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+	@"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+	User defined.
+
+	@1 searches the text sequentially
+	@n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+	@0 uses a goroutine for every CPU core
+	The search is sequential while tracing.
+*/
+const workers int = 1
+
 /**
 	Implementation of Knuth-Morris-Pratt algorithm (Prefix based aproach).
 
@@ -37,48 +95,172 @@ func main() {
 		fmt.Printf("\nRunning: Knuth-Morris-Pratt algorithm.\n\n")
 		fmt.Printf("Search word (%d chars long): %q.\n",len(args[1]), pattern)
 		fmt.Printf("Text        (%d chars long): %q.\n\n",len(s), s)
-		knp(s, pattern)
+		setTracer(s)
+		st := &matching.Stats{}
+		printResult(pattern, runKnp(matching.TextInput(s), pattern, st), st)
+		export(s, pattern)
 	} else if (commandLineInput == false) { //in case of file input
 		patFile, err := ioutil.ReadFile("pattern.txt")
 		if err != nil {
 			log.Fatal(err)
 		}
-		textFile, err := ioutil.ReadFile("text.txt")
+		in, err := matching.OpenInput(inputFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if (len(patFile) > len(textFile)) {
+		defer in.Close()
+		if (traceMode != "" || exportFormat != "") { //both show the text, so a streamed one is read whole
+			if err := in.ReadAll(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if (in.Whole() && len(patFile) > len(in.Text)) {
 			log.Fatal("Pattern  is longer than text!")
 		}
 		fmt.Printf("\nRunning: Knuth-Morris-Pratt algorithm.\n\n")
 		fmt.Printf("Search word (%d chars long): %q.\n",len(patFile), patFile)
-		fmt.Printf("Text        (%d chars long): %q.\n\n",len(textFile), textFile)
-		knp(string(textFile), string(patFile))
+		fmt.Printf("Text        (%s): %s.\n\n", in.Length(), in.Preview())
+		setTracer(in.Text)
+		st := &matching.Stats{}
+		printResult(string(patFile), runKnp(in, string(patFile), st), st)
+		export(in.Text, string(patFile))
 	}
 }
 
+/**
+	Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+	var err error
+	if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Exports KMP automaton of 'word' according to exportFormat,
+	with transitions taken while searching in 'text' if exportSearchPath is set.
+*/
+func export(text, word string) {
+	if (exportFormat == "" || len(word) == 0) {
+		return
+	}
+	t := kmp_table(word)
+	g := kmpGraph(word, t)
+	if (exportSearchPath == true) {
+		path, previous := matching.NewSearchPath(), trace
+		trace = path
+		knpSearch(text, word, t, nil)
+		trace = previous
+		g.Highlight(path)
+	}
+	if err := matching.ExportGraph(g, exportFormat); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Graph of the automaton hidden in the table 't' of 'word': state i means i matched characters
+	and the dashed links are the failure function t[i] (state 0 has none, the window moves instead).
+*/
+func kmpGraph(word string, t []int) *matching.Graph {
+	at := make(map[int]map[uint8]int)
+	for i := 0; i <= len(word); i++ {
+		at[i] = make(map[uint8]int)
+		if (i < len(word)) {
+			at[i][word[i]] = i + 1
+		}
+	}
+	g := matching.NewGraph(fmt.Sprintf("KMP automaton of %q", word), at)
+	for i := 1; i <= len(word); i++ {
+		g.Links[i] = t[i]
+	}
+	g.Final[len(word)] = true
+	return g
+}
+
+/**
+	Prints positions of all occurences of 'word' or that it was not found, and statistics of the search.
+*/
+func printResult(word string, occurences []int, st *matching.Stats) {
+	if (len(occurences) == 0) {
+		fmt.Printf("\n\nWord was not found.\n%s", st)
+		return
+	}
+	fmt.Printf("\n\nWord %q was found %d times at positions: ", word, len(occurences))
+	for k := 0; k<len(occurences)-1; k++ {
+		fmt.Printf("%d, ",occurences[k])
+	}
+	fmt.Printf("%d.\n%s", occurences[len(occurences)-1], st)
+}
+
 /**
 	Function knp performing the Knuth-Morris-Pratt algorithm.
-	Prints whether the word/pattern was found and on what position in the text or not.
+	Returns positions of all occurences of the word/pattern in the text (none for an empty word).
 	
 	@param text string/text to be searched in
 	@param word word/pattern to be serached for
+	@param st statistics to be filled, nil if not wanted
+	@return occurences positions in text, in increasing order
 */  
-func knp(text, word string) {
-	m, i, c := 0, 0, 0 //m - current match in text, i - current character in w, c - ammount of comparations
+func knp(text, word string, st *matching.Stats) (occurences []int) {
+	if (len(word) == 0) {
+		return nil
+	}
+	if (st == nil) {
+		return knpSearch(text, word, kmp_table(word), nil)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
 	t := kmp_table(word)
+	st.Build, st.Memory, st.States = time.Since(start), matching.AllocatedBytes() - memory, len(t)
+	start = time.Now()
+	occurences = knpSearch(text, word, t, st)
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Searching part of knp, 't' is the table built by kmp_table for non-empty 'word'.
+	Counts comparisons and shifts into 'st' unless it is nil.
+*/
+func knpSearch(text, word string, t []int, st *matching.Stats) (occurences []int) {
+	m, i := 0, 0 //m - current match in text, i - current character in w
 	for  m + i < len(text) {
-		fmt.Printf("\n   comparing characters %c %c at positions %d %d",text[m+i],word[i], m+i, i)
-		c++
+		if (st != nil) {
+			st.Comparisons++
+		}
 		if (word[i] == text[m+i]) {
-			fmt.Printf(" - match")
+			if (trace != nil) {
+				trace.Compared(m+i, text[m+i], i, i+1)
+			}
 			if (i == len(word) - 1) {
-				fmt.Printf("\n\nWord %q was found at position %d in %q. \n%d comparisons were done.",word, m, text,c)
-				return
+				occurences = append(occurences, m)
+				if (trace != nil) {
+					trace.MatchFound(0, m)
+				}
+				//continues with the longest border of the whole word
+				m = m + len(word) - t[len(word)]
+				i = t[len(word)]
+				if (st != nil) {
+					st.Shifts++
+					st.Shifted += len(word) - i
+				}
+				if (trace != nil) {
+					trace.WindowMoved(m, len(word) - i)
+				}
+			} else {
+				i++
 			}
-			i++
 		} else {
+			if (trace != nil) {
+				trace.Compared(m+i, text[m+i], i, -1)
+				trace.WindowMoved(m + i - t[i], i - t[i])
+			}
 			m = m + i - t[i]
+			if (st != nil) {
+				st.Shifts++
+				st.Shifted += i - t[i]
+			}
 			if (t[i] > -1) {
 				i = t[i]
 			} else {
@@ -86,21 +268,21 @@ func knp(text, word string) {
 			} 
 		}
 	}
-	fmt.Printf("\n\nWord was not found.\n%d comparisons were done.",c)
-	return
+	return occurences
 }
 
 /**
 	Table building alghoritm.
+	t[i] is the length of the longest proper border of word[:i], t[0] = -1.
 	
-	@param word word to be analyzed
-	@param t table to be filled
+	@param word word to be analyzed (at least one character long)
+	@param t table to be filled, one item longer than the word
 */
 func kmp_table(word string)(t []int) {
-	t = make([]int, len(word))
+	t = make([]int, len(word)+1)
     pos, cnd := 2, 0
 	t[0], t[1] = -1, 0
-	for pos < len(word) {
+	for pos <= len(word) {
 		if (word[pos-1] == word[cnd]) {
 			cnd++
 			t[pos] = cnd
@@ -113,4 +295,108 @@ func kmp_table(word string)(t []int) {
 		}
 	}
     return t
-}
\ No newline at end of file
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+	Runs knp, with the table loaded from automatonFile if it is set (loading is measured as building),
+	searching in chunks on several goroutines according to workers.
+	A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runKnp(in *matching.Input, word string, st *matching.Stats) []int {
+	n := matching.Workers(workers, trace != nil)
+	if ((in.Whole() && automatonFile == "" && n == 1) || len(word) == 0) {
+		return knp(in.Text, word, st)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	c, err := loadOrCompile(automatonFile, word)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Build, st.Memory, st.States = time.Since(start), matching.AllocatedBytes() - memory, len(c.table)
+	start = time.Now()
+	occurences, err := in.Search(c.overlap(), n, st, matching.Single(c.search))
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Search = time.Since(start)
+	return occurences[0]
+}
+
+/**
+	Word with its table built by kmp_table, ready to be saved and searched with.
+*/
+type compiled struct {
+	word string
+	table []int
+}
+
+/**
+	Compiles non-empty 'word'.
+*/
+func compile(word string) *compiled {
+	return &compiled{word, kmp_table(word)}
+}
+
+/**
+	Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) search(text string, st *matching.Stats) []int {
+	return knpSearch(text, c.word, c.table, st)
+}
+
+/**
+	Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) overlap() int {
+	return len(c.word) - 1
+}
+
+const algorithmKmp = 1
+
+/**
+	Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+	e := &matching.Encoder{}
+	e.Text(c.word)
+	for _, v := range c.table[1:] { //t[0] is always -1
+		e.Uint(v)
+	}
+	return e.Save(w, algorithmKmp)
+}
+
+/**
+	Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+	d, err := matching.Load(r, algorithmKmp)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{word: d.Text()}
+	if d.Err == nil && len(c.word) == 0 {
+		d.Fail("empty word")
+	}
+	c.table = make([]int, len(c.word)+1)
+	c.table[0] = -1
+	for i := 1; i < len(c.table); i++ {
+		if c.table[i] = d.Uint(); c.table[i] >= i {
+			d.Fail("border %d of prefix of length %d", c.table[i], i)
+		}
+	}
+	if err := d.End(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+	Loads matcher for 'word' from file 'path', or compiles it and saves it there
+	if the file does not exist or holds a matcher of another pattern.
+	Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path, word string) (*compiled, error) {
+	return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(word) },
+		func(c *compiled) bool { return c.word == word })
+}
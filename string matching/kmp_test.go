@@ -0,0 +1,92 @@
+package main
+import ("testing"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	KMP as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "knp",
+	Search: func(text string, p []string, st *matching.Stats) map[int][]int {
+		return matchingtest.Found(knp(text, p[0], st))
+	},
+	Trace: &trace,
+	Comparisons: true,
+	Algorithm: algorithmKmp,
+	Compile: func(p []string) *compiled { return compile(p[0]) },
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: func(path string, p []string) (*compiled, error) { return loadOrCompile(path, p[0]) },
+	Compiled: func(c *compiled) matching.Search { return matchingtest.Single(c.search) },
+	Overlap: (*compiled).overlap,
+	Patterns: func(c *compiled) []string { return []string{c.word} },
+	Verifies: true,
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzKnp kmp.go kmp_test.go
+	Inputs that failed are saved in testdata/fuzz/FuzzKnp and checked by every go test.
+*/
+func FuzzKnp(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	defer func() { trace = nil }()
+	word := "abab"
+	table := kmp_table(word)
+	g, path := kmpGraph(word, table), matching.NewSearchPath()
+	trace = path
+	knpSearch("abaabab", word, table, nil)
+	trace = nil
+	g.Highlight(path)
+	matchingtest.CheckGraph(t, g, "3 -> 1 [style=dashed, color=red, penwidth=2, constraint=false];")
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled kmp.go kmp_test.go
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -run XXX -bench . kmp.go kmp_test.go
+	Building the table and searching for the first pattern of each corpus are measured separately.
+*/
+func BenchmarkKnp(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, "multiple string matching", func(text string, p []string) func() {
+		t := kmp_table(p[0])
+		return func() { knpSearch(text, p[0], t, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
@@ -0,0 +1,309 @@
+package matching
+
+import ("encoding/binary"; "fmt"; "hash/crc32"; "io"; "io/ioutil"; "os"; "sort")
+
+/**
+	Compiled matchers are saved as: magic "SMAT", version and algorithm (one byte each),
+	the data in varints and CRC-32 (IEEE, little endian) of everything before it.
+	Loading checks all of it, so that a damaged or foreign file is refused instead of searching wrong.
+	Every program writes its own data with an Encoder and reads it with a Decoder.
+*/
+const Magic = "SMAT"
+const Version = 1
+
+/**
+	Appends varints to 'Buf'.
+*/
+type Encoder struct {
+	Buf []byte
+}
+
+func (e *Encoder) Uint(v int) {
+	e.Buf = binary.AppendUvarint(e.Buf, uint64(v))
+}
+
+func (e *Encoder) Int(v int) {
+	e.Buf = binary.AppendVarint(e.Buf, int64(v))
+}
+
+func (e *Encoder) Byte(b uint8) {
+	e.Buf = append(e.Buf, b)
+}
+
+func (e *Encoder) Text(s string) {
+	e.Uint(len(s))
+	e.Buf = append(e.Buf, s...)
+}
+
+/**
+	Writes automaton 'at' with states numbered from 0, transitions of each state sorted by character.
+*/
+func (e *Encoder) Automaton(at map[int]map[uint8]int) {
+	e.Uint(len(at))
+	for state := 0; state < len(at); state++ {
+		chars := make([]int, 0, len(at[state]))
+		for c := range at[state] {
+			chars = append(chars, int(c))
+		}
+		sort.Ints(chars)
+		e.Uint(len(chars))
+		for _, c := range chars {
+			e.Byte(uint8(c))
+			e.Uint(at[state][uint8(c)])
+		}
+	}
+}
+
+func (e *Encoder) Patterns(p []string) {
+	e.Uint(len(p))
+	for _, s := range p {
+		e.Text(s)
+	}
+}
+
+/**
+	Writes output sets 'f' sorted by state.
+*/
+func (e *Encoder) Outputs(f map[int][]int) {
+	states := make([]int, 0, len(f))
+	for state := range f {
+		states = append(states, state)
+	}
+	sort.Ints(states)
+	e.Uint(len(states))
+	for _, state := range states {
+		e.Uint(state)
+		e.Uint(len(f[state]))
+		for _, i := range f[state] {
+			e.Uint(i)
+		}
+	}
+}
+
+/**
+	Writes the data sealed as a compiled matcher of 'algorithm' to 'w'.
+*/
+func (e *Encoder) Save(w io.Writer, algorithm uint8) error {
+	_, err := w.Write(Seal(algorithm, e.Buf))
+	return err
+}
+
+/**
+	Reads varints from 'Data', the first error is kept in 'Err' and all following reads return zero.
+*/
+type Decoder struct {
+	Data []byte
+	Err error
+}
+
+/**
+	Reads compiled matcher of 'algorithm' from 'r' and returns decoder of its data.
+*/
+func Load(r io.Reader, algorithm uint8) (*Decoder, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := Unseal(algorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{Data: payload}, nil
+}
+
+func (d *Decoder) Fail(format string, a ...interface{}) {
+	if d.Err == nil {
+		d.Err = fmt.Errorf(format, a...)
+	}
+	d.Data = nil
+}
+
+func (d *Decoder) Uint() int {
+	v, n := binary.Uvarint(d.Data)
+	if n <= 0 || v > uint64(^uint(0)>>1) {
+		d.Fail("damaged number")
+		return 0
+	}
+	d.Data = d.Data[n:]
+	return int(v)
+}
+
+func (d *Decoder) Int() int {
+	v, n := binary.Varint(d.Data)
+	if n <= 0 {
+		d.Fail("damaged number")
+		return 0
+	}
+	d.Data = d.Data[n:]
+	return int(v)
+}
+
+func (d *Decoder) Byte() uint8 {
+	if len(d.Data) == 0 {
+		d.Fail("unexpected end of data")
+		return 0
+	}
+	b := d.Data[0]
+	d.Data = d.Data[1:]
+	return b
+}
+
+/**
+	Reads number of following items, each of them takes at least one byte.
+*/
+func (d *Decoder) Count() int {
+	n := d.Uint()
+	if n > len(d.Data) {
+		d.Fail("count %d exceeds the data", n)
+		return 0
+	}
+	return n
+}
+
+func (d *Decoder) Text() string {
+	n := d.Count()
+	s := string(d.Data[:n])
+	d.Data = d.Data[n:]
+	return s
+}
+
+/**
+	Reads automaton written by Encoder.Automaton, transitions have to lead to existing states.
+*/
+func (d *Decoder) Automaton() map[int]map[uint8]int {
+	at := make(map[int]map[uint8]int)
+	states := d.Count()
+	for state := 0; state < states; state++ {
+		at[state] = make(map[uint8]int)
+		transitions := d.Count()
+		for i := 0; i < transitions; i++ {
+			c, to := d.Byte(), d.Uint()
+			if to >= states {
+				d.Fail("transition to state %d, there are %d", to, states)
+			}
+			at[state][c] = to
+		}
+	}
+	return at
+}
+
+func (d *Decoder) Patterns() []string {
+	p := make([]string, d.Count())
+	for i := range p {
+		p[i] = d.Text()
+	}
+	return p
+}
+
+/**
+	Reads output sets written by Encoder.Outputs for automaton with 'states' states,
+	patterns of 'p' in the sets have to be at least 'lmin' long.
+*/
+func (d *Decoder) Outputs(states int, p []string, lmin int) map[int][]int {
+	f := make(map[int][]int)
+	n := d.Count()
+	for i := 0; i < n; i++ {
+		state, k := d.Uint(), d.Count()
+		if state >= states {
+			d.Fail("output set of state %d, there are %d", state, states)
+		}
+		for j := 0; j < k; j++ {
+			index := d.Uint()
+			if index >= len(p) || len(p[index]) < lmin {
+				d.Fail("output set has pattern %d, there are %d", index, len(p))
+				return f
+			}
+			f[state] = append(f[state], index)
+		}
+	}
+	return f
+}
+
+/**
+	Returns the first error of decoding, or an error if anything is left after the data.
+*/
+func (d *Decoder) End() error {
+	if d.Err == nil && len(d.Data) > 0 {
+		d.Fail("%d bytes after the data", len(d.Data))
+	}
+	return d.Err
+}
+
+/**
+	Returns header, 'payload' and checksum of a compiled matcher of 'algorithm'.
+*/
+func Seal(algorithm uint8, payload []byte) []byte {
+	data := append([]byte(Magic), Version, algorithm)
+	data = append(data, payload...)
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+/**
+	Checks header and checksum of 'data' and returns the payload.
+*/
+func Unseal(algorithm uint8, data []byte) ([]byte, error) {
+	header := len(Magic)+2
+	if len(data) < header+4 || string(data[:len(Magic)]) != Magic {
+		return nil, fmt.Errorf("not a compiled matcher")
+	}
+	if data[len(Magic)] != Version {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", data[len(Magic)], Version)
+	}
+	if data[len(Magic)+1] != algorithm {
+		return nil, fmt.Errorf("matcher of algorithm %d, expected %d", data[len(Magic)+1], algorithm)
+	}
+	end := len(data)-4
+	if crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+		return nil, fmt.Errorf("wrong checksum")
+	}
+	return data[header:end], nil
+}
+
+/**
+	Loads compiled matcher from file 'path' with 'read', or compiles it and saves it there with 'write'
+	if the file does not exist or 'same' tells it was compiled for other pattern(s).
+	Only compiles it when 'path' is empty.
+*/
+func LoadOrCompile[C any](path string, read func(io.Reader) (C, error), write func(io.Writer, C) error, compile func() C, same func(C) bool) (C, error) {
+	var none C
+	if (path == "") {
+		return compile(), nil
+	}
+	file, err := os.Open(path)
+	if err == nil {
+		c, err := read(file)
+		file.Close()
+		if err != nil {
+			return none, fmt.Errorf("%s: %v", path, err)
+		}
+		if same(c) {
+			return c, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return none, err
+	}
+	c := compile()
+	if file, err = os.Create(path); err != nil {
+		return none, err
+	}
+	if err := write(file, c); err != nil {
+		file.Close()
+		return none, err
+	}
+	return c, file.Close()
+}
+
+/**
+	Returns 'true' if 'a' and 'b' are the same patterns in the same order.
+*/
+func SamePatterns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
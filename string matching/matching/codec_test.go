@@ -0,0 +1,141 @@
+package matching
+
+import ("bytes"; "encoding/binary"; "hash/crc32"; "io"; "io/ioutil"; "path/filepath"; "reflect"; "strings"; "testing")
+
+const testAlgorithm = 9
+
+/**
+	Data of every kind written by an encoder, read back by a decoder.
+*/
+type example struct {
+	n, negative int
+	b uint8
+	text string
+	at map[int]map[uint8]int
+	patterns []string
+	f map[int][]int
+}
+
+var sample = example{300, -7, 0xff, "abc", map[int]map[uint8]int{0: {'a': 1, 'b': 2}, 1: {}, 2: {'a': 1}},
+	[]string{"ab", "b", ""}, map[int][]int{1: {0, 1}, 2: {1}}}
+
+func writeExample(w io.Writer, x example) error {
+	e := &Encoder{}
+	e.Uint(x.n)
+	e.Int(x.negative)
+	e.Byte(x.b)
+	e.Text(x.text)
+	e.Automaton(x.at)
+	e.Patterns(x.patterns)
+	e.Outputs(x.f)
+	return e.Save(w, testAlgorithm)
+}
+
+func readExample(r io.Reader) (x example, err error) {
+	d, err := Load(r, testAlgorithm)
+	if err != nil {
+		return x, err
+	}
+	x = example{n: d.Uint(), negative: d.Int(), b: d.Byte(), text: d.Text(), at: d.Automaton(), patterns: d.Patterns()}
+	x.f = d.Outputs(len(x.at), x.patterns, 1)
+	return x, d.End()
+}
+
+/**
+	Everything written is read back the same. Every damaged byte, shorter data,
+	other version or algorithm and data left after the end are refused.
+*/
+func TestCodec(t *testing.T) {
+	var file bytes.Buffer
+	if err := writeExample(&file, sample); err != nil {
+		t.Fatal(err)
+	}
+	x, err := readExample(bytes.NewReader(file.Bytes()))
+	if err != nil || !reflect.DeepEqual(x, sample) {
+		t.Fatalf("read %+v (%v), written %+v", x, err, sample)
+	}
+	data := file.Bytes()
+	for i := range data {
+		damaged := append([]byte(nil), data...)
+		damaged[i] ^= 0xff
+		if _, err := readExample(bytes.NewReader(damaged)); err == nil {
+			t.Errorf("damaged byte %d accepted", i)
+		}
+		if _, err := readExample(bytes.NewReader(data[:i])); err == nil {
+			t.Errorf("first %d bytes accepted", i)
+		}
+	}
+	payload, _ := Unseal(testAlgorithm, data)
+	other := append([]byte(Magic), Version + 1, testAlgorithm)
+	other = append(other, payload...)
+	other = binary.LittleEndian.AppendUint32(other, crc32.ChecksumIEEE(other))
+	if _, err := readExample(bytes.NewReader(other)); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("other version accepted (%v)", err)
+	}
+	if _, err := Load(bytes.NewReader(data), testAlgorithm + 1); err == nil || !strings.Contains(err.Error(), "algorithm") {
+		t.Errorf("other algorithm accepted (%v)", err)
+	}
+	if _, err := readExample(bytes.NewReader(Seal(testAlgorithm, append(payload, 0)))); err == nil || !strings.Contains(err.Error(), "after the data") {
+		t.Errorf("data after the end accepted (%v)", err)
+	}
+}
+
+/**
+	Decoder keeps the first error and refuses counts, transitions and output sets out of range.
+*/
+func TestDecoderErrors(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		payload []byte
+		read func(d *Decoder)
+	}{
+		{"count", []byte{5, 'a'}, func(d *Decoder) { d.Text() }},
+		{"transition", []byte{1, 1, 'a', 1}, func(d *Decoder) { d.Automaton() }},
+		{"output set", []byte{1, 0, 1, 1}, func(d *Decoder) { d.Outputs(1, []string{"a"}, 1) }},
+		{"short pattern", []byte{1, 0, 1, 0}, func(d *Decoder) { d.Outputs(1, []string{"a"}, 2) }},
+		{"number", []byte{0x80}, func(d *Decoder) { d.Uint() }},
+	} {
+		d := &Decoder{Data: c.payload}
+		c.read(d)
+		first := d.Err
+		d.Byte()
+		if first == nil || d.Err != first || d.Uint() != 0 {
+			t.Errorf("%s: error %v, then %v", c.name, first, d.Err)
+		}
+	}
+}
+
+/**
+	File is created by the first load, reused by the second and rebuilt for other data.
+*/
+func TestLoadOrCompile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "automaton.bin")
+	compiled := 0
+	load := func(x example) (example, error) {
+		return LoadOrCompile(path, readExample, writeExample, func() example { compiled++; return x },
+			func(loaded example) bool { return loaded.text == x.text })
+	}
+	first, err := load(sample)
+	if err != nil || compiled != 1 {
+		t.Fatalf("%v, compiled %d times", err, compiled)
+	}
+	second, err := load(sample)
+	if err != nil || compiled != 1 || !reflect.DeepEqual(first, second) {
+		t.Errorf("loaded %+v (%v), compiled %d times", second, err, compiled)
+	}
+	other := sample
+	other.text = "other"
+	if x, err := load(other); err != nil || compiled != 2 || x.text != "other" {
+		t.Errorf("matcher was not rebuilt (%v)", err)
+	}
+	ioutil.WriteFile(path, []byte("garbage"), 0644)
+	if _, err := load(sample); err == nil {
+		t.Errorf("garbage accepted")
+	}
+	if x, err := LoadOrCompile("", readExample, writeExample, func() example { return sample }, nil); err != nil || x.text != sample.text {
+		t.Errorf("compiling without a file failed (%v)", err)
+	}
+	if !SamePatterns([]string{"a", "b"}, []string{"a", "b"}) || SamePatterns([]string{"a", "b"}, []string{"b", "a"}) || SamePatterns(nil, []string{""}) {
+		t.Errorf("SamePatterns is wrong")
+	}
+}
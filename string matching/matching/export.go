@@ -0,0 +1,219 @@
+package matching
+
+import ("fmt"; "io"; "os"; "sort"; "strconv"; "strings")
+
+/**
+	Automaton prepared for drawing, states are numbered from 0 to 'States'-1
+	and transitions between the same two states are merged into one edge.
+
+	@field 'Edges' characters of the transitions, key is {from, to}
+	@field 'Links' dashed edges (supply or failure function), key is the state they go from
+	@field 'Final' states drawn with double circle, 'Labels' extra text of states (e.g. patterns ending there)
+	@field 'Visited', 'VisitedLinks' edges taken by a search, drawn highlighted
+*/
+type Graph struct {
+	Name string
+	States int
+	Edges map[[2]int][]uint8
+	Links map[int]int
+	Final map[int]bool
+	Labels map[int]string
+	Visited map[[2]int]bool
+	VisitedLinks map[int]bool
+}
+
+/**
+	Returns graph of automaton 'at' without links, final states and labels.
+*/
+func NewGraph(name string, at map[int]map[uint8]int) *Graph {
+	g := &Graph{Name: name, States: len(at), Edges: make(map[[2]int][]uint8), Links: make(map[int]int),
+		Final: make(map[int]bool), Labels: make(map[int]string), Visited: make(map[[2]int]bool), VisitedLinks: make(map[int]bool)}
+	for from, transitions := range at {
+		for c, to := range transitions {
+			g.Edges[[2]int{from, to}] = append(g.Edges[[2]int{from, to}], c)
+		}
+	}
+	for key := range g.Edges {
+		sort.Slice(g.Edges[key], func(i, j int) bool { return g.Edges[key][i] < g.Edges[key][j] })
+	}
+	return g
+}
+
+/**
+	Marks states of 'f' as final and labels them with indexes of the patterns ending there.
+*/
+func (g *Graph) AddOutputSets(f map[int][]int) {
+	for state, patterns := range f {
+		indexes := make([]string, len(patterns))
+		for i := range patterns {
+			indexes[i] = strconv.Itoa(patterns[i])
+		}
+		g.Final[state], g.Labels[state] = true, "\n{"+strings.Join(indexes, ", ")+"}"
+	}
+}
+
+/**
+	Tracer collecting transitions read by a search, see Graph.Highlight.
+*/
+type SearchPath struct {
+	transitions map[[2]int]bool
+	failed map[int]bool
+}
+
+func NewSearchPath() *SearchPath {
+	return &SearchPath{transitions: make(map[[2]int]bool), failed: make(map[int]bool)}
+}
+
+func (sp *SearchPath) StateCreated(state int) {}
+func (sp *SearchPath) TransitionAdded(from int, over uint8, to int) {}
+func (sp *SearchPath) WindowMoved(pos, shift int) {}
+func (sp *SearchPath) MatchFound(pattern, pos int) {}
+
+func (sp *SearchPath) Compared(pos int, c uint8, state, next int) {
+	if next == -1 {
+		sp.failed[state] = true
+	} else {
+		sp.transitions[[2]int{state, next}] = true
+	}
+}
+
+/**
+	Highlights transitions taken by the search and links followed after a failed one.
+*/
+func (g *Graph) Highlight(sp *SearchPath) {
+	for key := range sp.transitions {
+		g.Visited[key] = true
+	}
+	for state := range sp.failed {
+		if _, ok := g.Links[state]; ok {
+			g.VisitedLinks[state] = true
+		}
+	}
+}
+
+/**
+	Edges sorted by the states they go from and to, so that the output is always the same.
+*/
+func (g *Graph) sortedEdges() (keys [][2]int) {
+	for key := range g.Edges {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	return keys
+}
+
+/**
+	Characters of one edge separated by spaces. Letters, digits and some punctuation
+	are written as they are, space as '␣' and other bytes in hex, so that any label is safe in DOT and Mermaid.
+*/
+func EdgeLabel(chars []uint8) string {
+	label := make([]string, len(chars))
+	for i, c := range chars {
+		switch {
+		case c == ' ':
+			label[i] = "␣"
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("_-.:!?@$%&*+=/'~^", c) >= 0:
+			label[i] = string([]uint8{c})
+		default:
+			label[i] = fmt.Sprintf("0x%02x", c)
+		}
+	}
+	return strings.Join(label, " ")
+}
+
+/**
+	Writes the graph in Graphviz DOT language, render it with e.g. "dot -Tsvg automaton.dot".
+*/
+func (g *Graph) WriteDot(w io.Writer) {
+	fmt.Fprintf(w, "digraph %q {\n\trankdir=LR;\n\tnode [shape=circle];\n", g.Name)
+	for state := 0; state < g.States; state++ {
+		attributes := fmt.Sprintf("label=%q", strconv.Itoa(state)+g.Labels[state])
+		if g.Final[state] {
+			attributes += ", shape=doublecircle"
+		}
+		fmt.Fprintf(w, "\t%d [%s];\n", state, attributes)
+	}
+	for _, key := range g.sortedEdges() {
+		attributes := fmt.Sprintf("label=%q", EdgeLabel(g.Edges[key]))
+		if g.Visited[key] {
+			attributes += ", color=red, penwidth=2"
+		}
+		fmt.Fprintf(w, "\t%d -> %d [%s];\n", key[0], key[1], attributes)
+	}
+	for state := 0; state < g.States; state++ {
+		to, ok := g.Links[state]
+		if !ok {
+			continue
+		}
+		attributes := "style=dashed, color=gray"
+		if g.VisitedLinks[state] {
+			attributes = "style=dashed, color=red, penwidth=2"
+		}
+		fmt.Fprintf(w, "\t%d -> %d [%s, constraint=false];\n", state, to, attributes)
+	}
+	fmt.Fprintf(w, "}\n")
+}
+
+/**
+	Writes the graph as Mermaid flowchart, e.g. for Markdown documents.
+*/
+func (g *Graph) WriteMermaid(w io.Writer) {
+	fmt.Fprintf(w, "---\ntitle: %s\n---\nflowchart LR\n", g.Name)
+	var highlighted []string
+	for state := 0; state < g.States; state++ {
+		label := strconv.Itoa(state)+strings.Replace(g.Labels[state], "\n", "<br/>", -1)
+		if g.Final[state] {
+			fmt.Fprintf(w, "\ts%d(((\"%s\")))\n", state, label)
+		} else {
+			fmt.Fprintf(w, "\ts%d((\"%s\"))\n", state, label)
+		}
+	}
+	edge := 0
+	for _, key := range g.sortedEdges() {
+		fmt.Fprintf(w, "\ts%d -->|\"%s\"| s%d\n", key[0], EdgeLabel(g.Edges[key]), key[1])
+		if g.Visited[key] {
+			highlighted = append(highlighted, strconv.Itoa(edge))
+		}
+		edge++
+	}
+	for state := 0; state < g.States; state++ {
+		if to, ok := g.Links[state]; ok {
+			fmt.Fprintf(w, "\ts%d -.-> s%d\n", state, to)
+			if g.VisitedLinks[state] {
+				highlighted = append(highlighted, strconv.Itoa(edge))
+			}
+			edge++
+		}
+	}
+	if len(highlighted) > 0 {
+		fmt.Fprintf(w, "\tlinkStyle %s stroke:red,stroke-width:3px\n", strings.Join(highlighted, ","))
+	}
+}
+
+/**
+	Writes graph 'g' to file "automaton.dot" or "automaton.mmd" according to 'format' ("dot" or "mermaid").
+*/
+func ExportGraph(g *Graph, format string) error {
+	var path string
+	var write func(io.Writer)
+	switch format {
+	case "dot":
+		path, write = "automaton.dot", g.WriteDot
+	case "mermaid":
+		path, write = "automaton.mmd", g.WriteMermaid
+	default:
+		return fmt.Errorf("unknown export format %q, use \"dot\" or \"mermaid\"", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	write(file)
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("\nAutomaton written to %s\n", path)
+	return nil
+}
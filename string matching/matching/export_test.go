@@ -0,0 +1,59 @@
+package matching
+
+import ("bytes"; "strings"; "testing")
+
+/**
+	Trie of "ab" and "ac" with a supply link and output sets, highlighted by a search reading "ab" and failing on 'd'.
+*/
+func exampleGraph() *Graph {
+	g := NewGraph("example", map[int]map[uint8]int{0: {'a': 1}, 1: {'b': 2, 'c': 3}, 2: {}, 3: {}})
+	g.Links[1], g.Links[2], g.Links[3] = 0, 0, 0
+	g.AddOutputSets(map[int][]int{2: {0}, 3: {1}})
+	path := NewSearchPath()
+	path.Compared(0, 'a', 0, 1)
+	path.Compared(1, 'b', 1, 2)
+	path.Compared(2, 'd', 2, -1)
+	g.Highlight(path)
+	return g
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	g := exampleGraph()
+	var dot, mermaid bytes.Buffer
+	g.WriteDot(&dot)
+	g.WriteMermaid(&mermaid)
+	edges := len(g.Edges)+len(g.Links)
+	if n := strings.Count(dot.String(), " -> "); n != edges {
+		t.Errorf("%d edges in DOT, expected %d:\n%s", n, edges, dot.String())
+	}
+	if n := strings.Count(mermaid.String(), "-->|")+strings.Count(mermaid.String(), "-.->"); n != edges {
+		t.Errorf("%d edges in Mermaid, expected %d:\n%s", n, edges, mermaid.String())
+	}
+	if n := strings.Count(dot.String(), "doublecircle"); n != 2 {
+		t.Errorf("%d final states in DOT, expected 2:\n%s", n, dot.String())
+	}
+	for _, expected := range []string{"2 [label=\"2\\n{0}\", shape=doublecircle];", "0 -> 1 [label=\"a\", color=red, penwidth=2];",
+		"1 -> 3 [label=\"c\"];", "2 -> 0 [style=dashed, color=red, penwidth=2, constraint=false];", "3 -> 0 [style=dashed, color=gray, constraint=false];"} {
+		if !strings.Contains(dot.String(), expected) {
+			t.Errorf("%q missing in:\n%s", expected, dot.String())
+		}
+	}
+	if !strings.Contains(mermaid.String(), "s2(((\"2<br/>{0}\")))") || !strings.Contains(mermaid.String(), "linkStyle 0,1,4 stroke:red") {
+		t.Errorf("wrong Mermaid:\n%s", mermaid.String())
+	}
+	if label := EdgeLabel([]uint8{'a', ' ', '"', 0}); label != "a ␣ 0x22 0x00" {
+		t.Errorf("EdgeLabel = %q", label)
+	}
+}
+
+/**
+	Unknown export format is refused before anything is written.
+*/
+func TestExportGraphFormat(t *testing.T) {
+	if err := ExportGraph(exampleGraph(), "svg"); err == nil {
+		t.Errorf("unknown format accepted")
+	}
+}
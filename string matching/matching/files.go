@@ -0,0 +1,245 @@
+package matching
+
+import ("bufio"; "flag"; "fmt"; "io"; "io/fs"; "io/ioutil"; "os"; "path/filepath"; "strings")
+
+/**
+	Patterns compiled by an algorithm, ready to be searched with. It is only read while searching,
+	so goroutines can share it.
+*/
+type Matcher interface {
+	Patterns() []string
+	Search(text string, st *Stats) map[int][]int
+	Overlap() int //characters by which chunks of a text searched apart must overlap, see SearchText
+}
+
+/**
+	Files with a zero byte among the first binaryPrefix bytes are binary.
+*/
+const binaryPrefix = 8000
+
+/**
+	Globs given by a repeatable command line flag.
+*/
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globs) Set(glob string) error {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("%q: %v", glob, err)
+	}
+	*g = append(*g, glob)
+	return nil
+}
+
+/**
+	Tells whether 'name' matches any of the globs.
+*/
+func (g globs) match(name string) bool {
+	for _, glob := range g {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+	Searches files with one compiled matcher and writes what it finds.
+*/
+type fileSearcher struct {
+	c Matcher
+	semantics Semantics
+	workers int
+	include, exclude globs
+	out, errors io.Writer
+	found, failed bool
+	lines, count, names, invert, color bool
+	before, after int
+}
+
+/**
+	Searches files for patterns compiled once by 'compile', with command line arguments
+	[-patterns file] [-include glob]... [-exclude glob]... [line mode options] [file, glob or directory]...
+	Directories are searched recursively (the current one when none is given), "-" is standard input.
+	Includes and excludes apply to names of files, excludes to names of directories as well.
+	Binary files are skipped, gzip and zstd compressed ones searched decompressed (zstd by the zstd command).
+	Files are streamed (see Input), so neither a long pipe nor a decompressed file has to fit in memory.
+	Every occurence selected by 'semantics' is written to 'out' as file:line:col:pattern, in order of the text.
+	Line mode (-lines, implied by the other options) writes matching lines as file:line:text instead,
+	with -A, -B or -C lines of context, only counts of lines with -c, names of files with -l and
+	lines without occurences with -v (see lineWriter). -color highlights the patterns in both.
+	@param workers goroutines searching chunks of a text, see SearchText
+	@return exit status as of grep: 0 when something was found, 1 when nothing, 2 after an error
+*/
+func SearchFiles(args []string, out, errors io.Writer, compile func(patterns []string) Matcher, semantics Semantics, workers int) int {
+	flags := flag.NewFlagSet("file search", flag.ContinueOnError)
+	flags.SetOutput(errors)
+	patternFile := flags.String("patterns", "patterns.txt", "file with the patterns separated by single spaces")
+	s := &fileSearcher{semantics: semantics, workers: workers, errors: errors}
+	flags.Var(&s.include, "include", "search only files whose name matches the glob (repeatable)")
+	flags.Var(&s.exclude, "exclude", "skip files and directories whose name matches the glob (repeatable)")
+	flags.BoolVar(&s.lines, "lines", false, "print matching lines instead of every occurence")
+	flags.BoolVar(&s.count, "c", false, "print only the number of matching lines of every file")
+	flags.BoolVar(&s.names, "l", false, "print only names of files with a matching line")
+	flags.BoolVar(&s.invert, "v", false, "select lines without any occurence")
+	after := flags.Int("A", -1, "print `n` lines of context after matching lines")
+	before := flags.Int("B", -1, "print `n` lines of context before matching lines")
+	context := flags.Int("C", 0, "print `n` lines of context around matching lines")
+	color := flags.String("color", "auto", "highlight matches: auto (on a terminal), always or never")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	s.before, s.after = *context, *context
+	if (*before >= 0) {
+		s.before = *before
+	}
+	if (*after >= 0) {
+		s.after = *after
+	}
+	if (s.before > 0 || s.after > 0 || s.count || s.names || s.invert) {
+		s.lines = true
+	}
+	switch *color {
+	case "always":
+		s.color = true
+	case "auto":
+		s.color = isTerminal(out)
+	case "never":
+	default:
+		fmt.Fprintf(errors, "-color %q: auto, always or never expected\n", *color)
+		return 2
+	}
+	patFile, err := ioutil.ReadFile(*patternFile)
+	if err != nil {
+		fmt.Fprintln(errors, err)
+		return 2
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(strings.TrimRight(string(patFile), "\r\n"), " ") { //newline ending the file is not a part of the last pattern
+		if (len(pattern) > 0) { //empty pattern would be found everywhere
+			patterns = append(patterns, pattern)
+		}
+	}
+	if (len(patterns) == 0) {
+		fmt.Fprintf(errors, "%s: no patterns\n", *patternFile)
+		return 2
+	}
+	s.c = compile(patterns)
+	buffered := bufio.NewWriter(out)
+	s.out = buffered
+	paths := flags.Args()
+	if (len(paths) == 0) {
+		paths = []string{"."}
+	}
+	for _, path := range paths {
+		s.searchArgument(path)
+	}
+	if err := buffered.Flush(); err != nil {
+		fmt.Fprintln(errors, err)
+		s.failed = true
+	}
+	if (s.failed) {
+		return 2
+	}
+	if (s.found) {
+		return 0
+	}
+	return 1
+}
+
+/**
+	Reports an error and continues with other files.
+*/
+func (s *fileSearcher) fail(err error) {
+	fmt.Fprintln(s.errors, err)
+	s.failed = true
+}
+
+/**
+	Searches a command line argument, a glob is expanded to the files and directories it matches.
+*/
+func (s *fileSearcher) searchArgument(arg string) {
+	if (arg == "-") {
+		s.searchFile("-")
+		return
+	}
+	paths, err := filepath.Glob(arg)
+	if (err != nil || len(paths) == 0) {
+		paths = []string{arg} //not a glob, or matching nothing: reported as a missing file
+	}
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if (err != nil) {
+				s.fail(err)
+				return nil
+			}
+			if (entry.IsDir()) {
+				if (path != root && s.exclude.match(entry.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if (entry.Type()&fs.ModeSymlink != 0) {
+				if info, err := os.Stat(path); (err == nil && info.IsDir()) {
+					return nil //links to directories are not followed
+				}
+			} else if (!entry.Type().IsRegular() && path != root) {
+				return nil //devices, sockets and pipes found in directories
+			}
+			if (s.exclude.match(entry.Name()) || (len(s.include) > 0 && !s.include.match(entry.Name()))) {
+				return nil
+			}
+			s.searchFile(path)
+			return nil
+		})
+		if (err != nil) {
+			s.fail(err)
+		}
+	}
+}
+
+/**
+	Searches one file chunk by chunk as it is read and writes its occurences, unless it is binary.
+*/
+func (s *fileSearcher) searchFile(path string) {
+	in, err := OpenInput(path)
+	if (err != nil) {
+		s.fail(err)
+		return
+	}
+	defer in.Close()
+	if err := in.Decompress(); (err != nil) {
+		s.fail(fmt.Errorf("%s: %v", path, err))
+		return
+	}
+	if (strings.IndexByte(in.Prefix(binaryPrefix), 0) >= 0) {
+		fmt.Fprintf(s.errors, "%s: binary file skipped\n", path)
+		return
+	}
+	if (path == "-") {
+		path = "(standard input)"
+	}
+	w, selector := s.newLineWriter(path), NewSelector(s.c.Patterns(), s.semantics)
+	err = in.Scan(s.c.Overlap(), s.workers, nil, s.c.Search, func(base int, chunk string, found map[int][]int) bool {
+		return w.write(base, chunk, selector.Select(SortOccurences(found)))
+	})
+	w.finish()
+	if (err != nil) {
+		s.fail(fmt.Errorf("%s: %v", path, err))
+	}
+}
+
+/**
+	Tells whether 'w' is a terminal, to highlight matches with -color auto.
+*/
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if (!ok) {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,233 @@
+package matching
+
+import ("bytes"; "compress/gzip"; "fmt"; "io/ioutil"; "math/rand"; "os"; "os/exec"; "path/filepath"; "strings"; "testing")
+
+/**
+	Matcher searching by naiveSearch.
+*/
+type naiveMatcher []string
+
+func (m naiveMatcher) Patterns() []string {
+	return m
+}
+
+func (m naiveMatcher) Search(text string, st *Stats) map[int][]int {
+	return naiveSearch(m)(text, st)
+}
+
+func (m naiveMatcher) Overlap() int {
+	return longest(m) - 1
+}
+
+func compileNaive(patterns []string) Matcher {
+	return naiveMatcher(patterns)
+}
+
+/**
+	Directories are searched recursively with includes and excludes, binary files skipped,
+	compressed files searched decompressed and occurences written as file:line:col:pattern.
+*/
+func TestSearchFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("patterns.txt", "he she his hers ")
+	write("a.txt", "ushers\nhis hat\n\nshe")
+	write("bin.txt", "he\x00")
+	write("skip/d.txt", "she")
+	write("sub/b.log", "here")
+	write("sub/c.txt", "he")
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("x\nhis"))
+	zw.Close()
+	write("e.txt.gz", compressed.String())
+	expected := []string{"a.txt:1:2:she", "a.txt:1:3:he", "a.txt:1:3:hers", "a.txt:2:1:his", "a.txt:4:1:she", "a.txt:4:2:he",
+		"e.txt.gz:2:1:his"}
+	expected = append(expected, "sub/c.txt:1:1:he")
+	for i := range expected {
+		expected[i] = filepath.Join(dir, expected[i])
+	}
+	search := func(args ...string) (int, string, string) {
+		var out, errors bytes.Buffer
+		status := SearchFiles(append([]string{"-patterns", filepath.Join(dir, "patterns.txt")}, args...), &out, &errors, compileNaive, AllOccurences, 1)
+		return status, out.String(), errors.String()
+	}
+	status, out, errors := search("-include", "*.txt", "-include", "*.gz", "-include", "*.zst", "-exclude", "skip", "-exclude", "patterns.txt", dir)
+	if status != 0 || out != strings.Join(expected, "\n") + "\n" {
+		t.Errorf("status %d, found:\n%s\nexpected:\n%s", status, out, strings.Join(expected, "\n"))
+	}
+	if errors != filepath.Join(dir, "bin.txt") + ": binary file skipped\n" {
+		t.Errorf("wrong errors %q", errors)
+	}
+	if status, out, _ := search(filepath.Join(dir, "sub", "*.log")); status != 0 || out != filepath.Join(dir, "sub", "b.log") + ":1:1:he\n" {
+		t.Errorf("glob: status %d, found %q", status, out)
+	}
+	if status, out, _ := search("-include", "*.none", dir); status != 1 || out != "" {
+		t.Errorf("nothing to search: status %d, found %q", status, out)
+	}
+	if status, _, errors := search(filepath.Join(dir, "missing.txt")); status != 2 || errors == "" {
+		t.Errorf("missing file: status %d, errors %q", status, errors)
+	}
+}
+
+/**
+	Zstd compressed files are searched decompressed by the zstd command, streamed when they are long
+	and reported as the whole file; a damaged one is an error.
+*/
+func TestSearchZstd(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd command is not installed")
+	}
+	dir := t.TempDir()
+	long := strings.Repeat("abcdefgh\n", streamChunk / 4) + "his hat"
+	for name, content := range map[string]string{"short.txt": "x\nushers", "long.txt": long} {
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdin = strings.NewReader(content)
+		compressed, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name + ".zst"), compressed, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{"patterns.txt": "he she his", "damaged.zst": zstdMagic + "hers"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := func(args ...string) (int, string, string) {
+		var out, errors bytes.Buffer
+		status := SearchFiles(append([]string{"-patterns", filepath.Join(dir, "patterns.txt")}, args...), &out, &errors, compileNaive, AllOccurences, 1)
+		return status, out.String(), errors.String()
+	}
+	short, long := filepath.Join(dir, "short.txt.zst"), filepath.Join(dir, "long.txt.zst")
+	if status, out, errors := search(short); status != 0 || out != short + ":2:2:she\n" + short + ":2:3:he\n" || errors != "" {
+		t.Errorf("status %d, found %q, errors %q", status, out, errors)
+	}
+	lines := streamChunk / 4 + 1
+	if status, out, errors := search(long); status != 0 || out != fmt.Sprintf("%s:%d:1:his\n", long, lines) || errors != "" {
+		t.Errorf("streamed: status %d, found %q, errors %q", status, out, errors)
+	}
+	if status, _, _ := search("-l", long); status != 0 {
+		t.Errorf("stopped early: status %d", status)
+	}
+	if status, _, errors := search(filepath.Join(dir, "damaged.zst")); status != 2 || !strings.Contains(errors, "zstd") {
+		t.Errorf("damaged: status %d, errors %q", status, errors)
+	}
+}
+
+/**
+	Line mode prints matching lines with context, counts, names of files, inverted selection
+	and highlighted matches, overlapping ones together; occurences are highlighted too.
+*/
+func TestLineMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.txt")
+	for name, content := range map[string]string{"patterns.txt": "error warn\n", "overlapping.txt": "she he hers",
+		"log.txt": "1 start\n2 error: disk\n3 ok\n4 ok\n5 ok\n6 warning\n7 ok\n8 error again\n", "empty.txt": ""} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct { //FILE stands for the searched file
+		args []string
+		status int
+		expected string
+	}{
+		{[]string{"-lines"}, 0, "FILE:2:2 error: disk\nFILE:6:6 warning\nFILE:8:8 error again\n"},
+		{[]string{"-C", "1"}, 0, "FILE-1-1 start\nFILE:2:2 error: disk\nFILE-3-3 ok\n--\nFILE-5-5 ok\nFILE:6:6 warning\nFILE-7-7 ok\nFILE:8:8 error again\n"},
+		{[]string{"-C", "3", "-A", "1", "-B", "0"}, 0, "FILE:2:2 error: disk\nFILE-3-3 ok\n--\nFILE:6:6 warning\nFILE-7-7 ok\nFILE:8:8 error again\n"},
+		{[]string{"-v"}, 0, "FILE:1:1 start\nFILE:3:3 ok\nFILE:4:4 ok\nFILE:5:5 ok\nFILE:7:7 ok\n"},
+		{[]string{"-c"}, 0, "FILE:3\n"},
+		{[]string{"-c", "-v"}, 0, "FILE:5\n"},
+		{[]string{"-l"}, 0, "FILE\n"},
+		{[]string{"-lines", "-color", "always", "-A", "1"}, 0, "FILE:2:2 \x1b[01;31merror\x1b[m: disk\nFILE-3-3 ok\n--\nFILE:6:6 \x1b[01;31mwarn\x1b[ming\nFILE-7-7 ok\nFILE:8:8 \x1b[01;31merror\x1b[m again\n"},
+		{[]string{"-patterns", filepath.Join(dir, "overlapping.txt"), "-color", "always", "-lines"}, 1, ""},
+		{[]string{"-color", "always"}, 0, "FILE:2:3:\x1b[01;31merror\x1b[m\nFILE:6:3:\x1b[01;31mwarn\x1b[m\nFILE:8:3:\x1b[01;31merror\x1b[m\n"},
+		{[]string{"-color", "never"}, 0, "FILE:2:3:error\nFILE:6:3:warn\nFILE:8:3:error\n"},
+		{[]string{"-color", "sometimes"}, 2, ""},
+	}
+	for _, test := range tests {
+		var out, errors bytes.Buffer
+		args := append([]string{"-patterns", filepath.Join(dir, "patterns.txt")}, test.args...)
+		status := SearchFiles(append(args, path), &out, &errors, compileNaive, AllOccurences, 1)
+		if expected := strings.ReplaceAll(test.expected, "FILE", path); status != test.status || out.String() != expected {
+			t.Errorf("%v: status %d, found:\n%s\nexpected status %d:\n%s", test.args, status, out.String(), test.status, expected)
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte("ushers\nno"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	SearchFiles([]string{"-patterns", filepath.Join(dir, "overlapping.txt"), "-color", "always", "-lines", path, filepath.Join(dir, "empty.txt")}, &out, &out, compileNaive, AllOccurences, 1)
+	if expected := path + ":1:u\x1b[01;31mshers\x1b[m\n"; out.String() != expected {
+		t.Errorf("found %q, expected %q", out.String(), expected)
+	}
+	out.Reset()
+	SearchFiles([]string{"-patterns", filepath.Join(dir, "overlapping.txt"), "-c", path, filepath.Join(dir, "empty.txt")}, &out, &out, compileNaive, AllOccurences, 1)
+	if expected := path + ":1\n" + filepath.Join(dir, "empty.txt") + ":0\n"; out.String() != expected {
+		t.Errorf("found %q, expected %q", out.String(), expected)
+	}
+}
+
+/**
+	A file streamed in chunks (decompressed from gzip) is reported the same as the whole file,
+	with lines, context and selected occurences crossing the chunks.
+*/
+func TestSearchStreamedFile(t *testing.T) {
+	dir := t.TempDir()
+	r := rand.New(rand.NewSource(1))
+	var text strings.Builder
+	for text.Len() < 3 * streamChunk {
+		if r.Intn(500) == 0 {
+			text.WriteString(randomString(r, "abcdefgh", streamChunk + r.Intn(1000))) //line longer than a chunk
+		} else {
+			text.WriteString(randomString(r, "abcdefgh", r.Intn(200)))
+		}
+		text.WriteByte('\n')
+	}
+	text.WriteString("abc hh") //last line without a newline
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(text.String()))
+	zw.Close()
+	for name, content := range map[string]string{"patterns.txt": "abcd abc cdef hh", "whole.txt": text.String(), "streamed.gz": compressed.String()} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{}, {"-C", "2", "-color", "always"}, {"-B", "1"}, {"-c"}, {"-v", "-c"}, {"-l"}} {
+		for _, semantics := range []Semantics{AllOccurences, LeftmostLongest} {
+			outputs := make(map[string]string)
+			for _, name := range []string{"whole.txt", "streamed.gz"} {
+				var out, errors bytes.Buffer
+				path := filepath.Join(dir, name)
+				status := SearchFiles(append(append([]string{"-patterns", filepath.Join(dir, "patterns.txt")}, args...), path), &out, &errors, compileNaive, semantics, 1)
+				if status != 0 || errors.Len() > 0 {
+					t.Fatalf("%v %s: status %d, errors %q", args, name, status, errors.String())
+				}
+				outputs[name] = strings.ReplaceAll(out.String(), path, "FILE")
+			}
+			if outputs["whole.txt"] != outputs["streamed.gz"] {
+				t.Errorf("%v by semantics %d: the streamed file differs, %d chars instead of %d", args, semantics, len(outputs["streamed.gz"]), len(outputs["whole.txt"]))
+			}
+		}
+	}
+	in, err := OpenInput(filepath.Join(dir, "streamed.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := in.Decompress(); err != nil || in.Whole() {
+		t.Errorf("decompressed file is not streamed (%v)", err)
+	}
+}
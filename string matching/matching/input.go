@@ -0,0 +1,328 @@
+package matching
+
+import ("bytes"; "compress/gzip"; "errors"; "fmt"; "io"; "io/ioutil"; "os"; "os/exec"; "strings"; "unsafe")
+
+/**
+	Texts longer than this are printed shortened.
+*/
+const previewLength = 1 << 10
+
+/**
+	Text that is not mapped into memory is read whole when it is at most this long,
+	a longer one is searched in chunks of this size, so that it never has to fit in memory.
+*/
+const streamChunk = 1 << 20
+
+/**
+	Text to be searched in. Regular files are mapped into memory where the system allows it
+	(see mapFile), the text then shares the pages of the file instead of being copied to the heap.
+	Pipes, standard input and files that cannot be mapped are read whole when they are short,
+	longer ones are streamed: searched chunk by chunk as they are read (see Scan).
+
+	@field 'Text' the whole text, empty while it is streamed
+*/
+type Input struct {
+	Text string
+	head []byte //beginning of a streamed text, already read
+	rest io.Reader //rest of a streamed text, nil when the text is whole
+	closers []func() error
+}
+
+/**
+	Opens the text of file 'path', "-" for standard input. Close it once the search is done.
+*/
+func OpenInput(path string) (*Input, error) {
+	in := &Input{}
+	f := os.Stdin
+	if (path != "-") {
+		var err error
+		if f, err = os.Open(path); (err != nil) {
+			return nil, err
+		}
+		in.closers = append(in.closers, f.Close)
+	}
+	info, err := f.Stat()
+	if (err != nil) {
+		in.Close()
+		return nil, err
+	}
+	size := info.Size()
+	if (info.Mode().IsRegular() && size > 0 && int64(int(size)) == size) {
+		if data, release, err := mapFile(f, int(size)); (err == nil) {
+			in.Text = unsafe.String(&data[0], len(data))
+			in.closers = append(in.closers, release)
+			return in, nil
+		}
+	}
+	if err := in.read(f); (err != nil) {
+		in.Close()
+		return nil, err
+	}
+	return in, nil
+}
+
+/**
+	Magic numbers of gzip and zstd compressed texts.
+*/
+const gzipMagic, zstdMagic = "\x1f\x8b", "\x28\xb5\x2f\xfd"
+
+/**
+	Decompresses a gzip or zstd compressed text as it is read, so a long one is streamed, not decompressed into memory.
+	Zstandard is not in the standard library, it is decompressed by the zstd command, which has to be installed.
+	Other texts are left as they are.
+*/
+func (in *Input) Decompress() error {
+	if (in.Prefix(len(zstdMagic)) == zstdMagic) {
+		return in.decompressZstd()
+	}
+	if (in.Prefix(len(gzipMagic)) != gzipMagic) {
+		return nil
+	}
+	r, err := gzip.NewReader(in.Reader())
+	if (err != nil) {
+		return err
+	}
+	in.closers = append(in.closers, r.Close)
+	return in.read(r)
+}
+
+/**
+	Streams the text through "zstd -d -c", the error of the command is returned when its output ends.
+*/
+func (in *Input) decompressZstd() error {
+	if _, err := exec.LookPath("zstd"); (err != nil) {
+		return errors.New("zstd compressed, but the zstd command is not installed")
+	}
+	r := &commandReader{cmd: exec.Command("zstd", "-d", "-c", "-q")}
+	r.cmd.Stdin, r.cmd.Stderr = in.Reader(), &r.message
+	out, err := r.cmd.StdoutPipe()
+	if (err != nil) {
+		return err
+	}
+	if err := r.cmd.Start(); (err != nil) {
+		return err
+	}
+	r.out = out
+	in.closers = append(in.closers, r.Close)
+	return in.read(r)
+}
+
+/**
+	Output of a running command, which ends with the error of the command if it failed.
+*/
+type commandReader struct {
+	cmd *exec.Cmd
+	out io.Reader
+	message bytes.Buffer //standard error of the command
+	done bool
+	err error
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	n, err := r.out.Read(p)
+	if (err == io.EOF) {
+		if err := r.wait(); (err != nil) {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+/**
+	Waits for the command to exit, once.
+*/
+func (r *commandReader) wait() error {
+	if (!r.done) {
+		r.done = true
+		if err := r.cmd.Wait(); (err != nil) {
+			r.err = fmt.Errorf("%s: %v %s", r.cmd.Args[0], err, strings.TrimSpace(r.message.String()))
+		}
+	}
+	return r.err
+}
+
+/**
+	Stops the command if its output was not read to the end (the search stopped early).
+*/
+func (r *commandReader) Close() error {
+	if (!r.done) {
+		r.cmd.Process.Kill()
+		r.wait()
+	}
+	return nil
+}
+
+/**
+	Returns input of 'text' already in memory.
+*/
+func TextInput(text string) *Input {
+	return &Input{Text: text}
+}
+
+/**
+	Reads the beginning of 'r': all of it when it is not longer than one chunk, otherwise the rest is streamed.
+	The buffer is never changed afterwards, so it is used as the text without copying it again.
+*/
+func (in *Input) read(r io.Reader) error {
+	head, err := ioutil.ReadAll(io.LimitReader(r, streamChunk + 1))
+	if (err != nil) {
+		return err
+	}
+	if (len(head) <= streamChunk) {
+		in.Text, in.head, in.rest = unsafe.String(unsafe.SliceData(head), len(head)), nil, nil
+		return nil
+	}
+	in.Text, in.head, in.rest = "", head, r
+	return nil
+}
+
+/**
+	Tells whether the whole text is in 'Text', false while it is streamed.
+*/
+func (in *Input) Whole() bool {
+	return in.rest == nil
+}
+
+/**
+	Returns the text as a reader, from its beginning. A streamed text can be read only once.
+*/
+func (in *Input) Reader() io.Reader {
+	if (in.Whole()) {
+		return strings.NewReader(in.Text)
+	}
+	return io.MultiReader(bytes.NewReader(in.head), in.rest)
+}
+
+/**
+	Reads the rest of a streamed text, so that the whole text is in 'Text'.
+	Tracing and export show the text, so they need it whole.
+*/
+func (in *Input) ReadAll() error {
+	if (in.Whole()) {
+		return nil
+	}
+	buffer := bytes.NewBuffer(in.head)
+	if _, err := buffer.ReadFrom(in.rest); (err != nil) {
+		return err
+	}
+	in.Text, in.head, in.rest = unsafe.String(unsafe.SliceData(buffer.Bytes()), buffer.Len()), nil, nil
+	return nil
+}
+
+/**
+	Returns at most 'n' first characters of the text.
+*/
+func (in *Input) Prefix(n int) string {
+	prefix := in.Text
+	if (!in.Whole()) {
+		prefix = unsafe.String(unsafe.SliceData(in.head), len(in.head))
+	}
+	if (len(prefix) > n) {
+		prefix = prefix[:n]
+	}
+	return prefix
+}
+
+/**
+	Length of the text as printed by the programs, a streamed text is not known before the search.
+*/
+func (in *Input) Length() string {
+	if (in.Whole()) {
+		return fmt.Sprintf("%d chars long", len(in.Text))
+	}
+	return fmt.Sprintf("streamed, more than %d chars", streamChunk)
+}
+
+/**
+	Returns the beginning of the text quoted, see Preview.
+*/
+func (in *Input) Preview() string {
+	return Preview(in.Prefix(previewLength + 1))
+}
+
+/**
+	Releases the mapping and closes the file.
+*/
+func (in *Input) Close() (err error) {
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if e := in.closers[i](); (e != nil && err == nil) {
+			err = e
+		}
+	}
+	in.closers = nil
+	return err
+}
+
+/**
+	Searches the text with 'search' on 'workers' goroutines (see SearchText) and passes the occurences to 'emit'
+	in order of the text. The whole text is one chunk. A streamed text is read in chunks extended by 'overlap'
+	characters (length of the longest pattern - 1) of the next one, so each occurence lies whole in the chunk
+	it starts in; occurences starting in the extension are left to the next chunk, which starts with it.
+	Only one chunk is kept in memory at a time.
+	@param emit gets position of the chunk in the text, the chunk without the extension (never changed, so it may
+	be kept) and the occurences starting in it (positions in the text); returns false to stop reading the text
+*/
+func (in *Input) Scan(overlap, workers int, st *Stats, search Search, emit func(base int, chunk string, found map[int][]int) bool) error {
+	if (in.Whole()) {
+		emit(0, in.Text, SearchText(in.Text, overlap, workers, st, search))
+		return nil
+	}
+	r := in.Reader()
+	size := streamChunk
+	if (size < 4 * overlap) {
+		size = 4 * overlap
+	}
+	chunk, base := make([]byte, 0, size + overlap), 0
+	for {
+		n, err := io.ReadFull(r, chunk[len(chunk):cap(chunk)])
+		chunk = chunk[:len(chunk) + n]
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if (err != nil && !last) {
+			return err
+		}
+		end := len(chunk)
+		if (!last) {
+			end -= overlap
+		}
+		text := unsafe.String(unsafe.SliceData(chunk), len(chunk)) //the chunk is never changed afterwards
+		found := make(map[int][]int)
+		for key, positions := range SearchText(text, overlap, workers, st, search) {
+			for _, pos := range positions {
+				if (pos < end) {
+					found[key] = append(found[key], base + pos)
+				}
+			}
+		}
+		if (!emit(base, text[:end], found) || last) {
+			return nil
+		}
+		next := make([]byte, len(chunk) - end, size + overlap)
+		copy(next, chunk[end:])
+		chunk, base = next, base + end
+	}
+}
+
+/**
+	Searches the text as Scan does and returns all the occurences.
+*/
+func (in *Input) Search(overlap, workers int, st *Stats, search Search) (map[int][]int, error) {
+	occurences := make(map[int][]int)
+	err := in.Scan(overlap, workers, st, search, func(base int, chunk string, found map[int][]int) bool {
+		for key, positions := range found {
+			occurences[key] = append(occurences[key], positions...)
+		}
+		return true
+	})
+	return occurences, err
+}
+
+/**
+	Returns the text quoted, only its beginning if it is longer than previewLength.
+	@param text the text
+*/
+func Preview(text string) string {
+	if len(text) > previewLength {
+		return fmt.Sprintf("%q... (shortened)", text[:previewLength])
+	}
+	return fmt.Sprintf("%q", text)
+}
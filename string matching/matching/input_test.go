@@ -0,0 +1,118 @@
+package matching
+
+import ("io/ioutil"; "os"; "path/filepath"; "reflect"; "runtime"; "strconv"; "strings"; "testing")
+
+/**
+	Regular files are read whole, mapped on Linux, and released.
+*/
+func TestOpenInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "text.txt")
+	for _, content := range []string{"", "a", strings.Repeat("abcd", 5000), strings.Repeat("abcd", streamChunk / 2)} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		in, err := OpenInput(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !in.Whole() || in.Text != content {
+			t.Errorf("read %d chars instead of %d", len(in.Text), len(content))
+		}
+		if mapped := len(in.closers) == 2; runtime.GOOS == "linux" && len(content) > 0 && !mapped {
+			t.Errorf("file of %d chars was not mapped", len(content))
+		}
+		if err := in.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := OpenInput(filepath.Join(filepath.Dir(path), "missing.txt")); err == nil {
+		t.Errorf("missing file accepted")
+	}
+	content := strings.Repeat("x", previewLength + 1)
+	if short := TextInput(content).Preview(); short != strconv.Quote(content[:previewLength]) + "... (shortened)" {
+		t.Errorf("wrong preview %.20s", short)
+	}
+	if short := Preview("ab"); short != `"ab"` || TextInput("ab").Length() != "2 chars long" {
+		t.Errorf("wrong preview %s", short)
+	}
+}
+
+/**
+	Writes 'content' to standard input through a pipe while it is opened and searched.
+*/
+func withStdin(t *testing.T, content string, read func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin; r.Close() }()
+	go func() {
+		w.WriteString(content)
+		w.Close()
+	}()
+	read()
+}
+
+/**
+	Short standard input is read whole. Longer one is streamed in chunks of at most streamChunk characters,
+	which follow each other, and finds the same occurences as the whole text, also those across chunks.
+*/
+func TestStream(t *testing.T) {
+	withStdin(t, "abcd", func() {
+		in, err := OpenInput("-")
+		if err != nil || !in.Whole() || in.Text != "abcd" {
+			t.Errorf("read %q from a pipe (%v)", in.Text, err)
+		}
+	})
+	patterns := []string{"ab", "bXXa", "b", strings.Repeat("a", 100)}
+	search := naiveSearch(patterns)
+	content := strings.Repeat("ab", streamChunk) + "XXa" + strings.Repeat("a", 3 * streamChunk / 2 - 1) + "b"
+	expected := search(content, nil)
+	if len(expected[1]) != 1 || expected[1][0] != 2 * streamChunk - 1 {
+		t.Fatalf("no occurence across chunks: %v", expected[1])
+	}
+	withStdin(t, content, func() {
+		in, err := OpenInput("-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Whole() || in.Prefix(3) != "aba" || !strings.HasPrefix(in.Length(), "streamed") {
+			t.Fatalf("long input is not streamed")
+		}
+		var read strings.Builder
+		found := make(map[int][]int)
+		err = in.Scan(longest(patterns) - 1, 2, nil, search, func(base int, chunk string, occurences map[int][]int) bool {
+			if base != read.Len() || len(chunk) > streamChunk {
+				t.Errorf("chunk of %d chars at %d after %d chars", len(chunk), base, read.Len())
+			}
+			read.WriteString(chunk)
+			for key, positions := range occurences {
+				found[key] = append(found[key], positions...)
+			}
+			return true
+		})
+		if err != nil || read.String() != content {
+			t.Fatalf("streamed %d chars of %d (%v)", read.Len(), len(content), err)
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("found %d, %d, %d and %d occurences, expected %d, %d, %d and %d", len(found[0]), len(found[1]), len(found[2]), len(found[3]),
+				len(expected[0]), len(expected[1]), len(expected[2]), len(expected[3]))
+		}
+	})
+	in := &Input{}
+	if err := in.read(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := in.Search(longest(patterns) - 1, 1, nil, search); err != nil || !reflect.DeepEqual(found, expected) {
+		t.Errorf("search of the stream differs (%v)", err)
+	}
+	in = &Input{}
+	if err := in.read(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.ReadAll(); err != nil || !in.Whole() || in.Text != content {
+		t.Errorf("read %d chars of %d whole (%v)", len(in.Text), len(content), err)
+	}
+}
@@ -0,0 +1,189 @@
+package matching
+
+import ("fmt"; "io"; "strings")
+
+/**
+	Escape sequences highlighting matches in color (as grep does).
+*/
+const highlightStart, highlightEnd = "\x1b[01;31m", "\x1b[m"
+
+/**
+	Line number 'number' of a text, starting at position 'start' of the text, without its newline.
+*/
+type line struct {
+	number, start int
+	text string
+}
+
+/**
+	Writes what the file search found in one file, as the chunks of the file come (see Input.Scan):
+	every occurence as file:line:col:pattern, or in line mode the lines selected by the occurences
+	(lines where an occurence starts, or the other lines with -v) with context lines around,
+	only their count with -c or only the name of the file with -l.
+	Lines are found as the text is read once, so mapping offsets to lines costs no more than the search.
+	Only the line a chunk ends in and the context lines before a selected one are kept from chunk to chunk.
+*/
+type lineWriter struct {
+	s *fileSearcher
+	path string
+	number, start int //number and position of the line the next chunk continues
+	counted int //position up to which newlines are counted
+	partial []byte //beginning of the line that continues in the next chunk, in line mode
+	matches []Occurence //occurences starting on that line
+	before []line //context lines waiting for a selected line
+	selected, last, after int //selected lines, number of the last written line, context lines still to be written after it
+	done bool
+}
+
+func (s *fileSearcher) newLineWriter(path string) *lineWriter {
+	return &lineWriter{s: s, path: path, number: 1}
+}
+
+/**
+	Writes what was found in the next chunk 'chunk' at position 'base' of the text.
+	@param found occurences selected in the chunk, sorted by position
+	@return false when the rest of the text is not needed
+*/
+func (w *lineWriter) write(base int, chunk string, found []Occurence) bool {
+	if (!w.s.lines) {
+		w.writeOccurences(base, chunk, found)
+		return true
+	}
+	next := 0
+	for pos := 0; pos < len(chunk) && !w.done; {
+		end := strings.IndexByte(chunk[pos:], '\n')
+		if (end < 0) { //the line continues in the next chunk
+			if (len(w.partial) == 0) {
+				w.start = base + pos
+			}
+			w.partial = append(w.partial, chunk[pos:]...)
+			w.matches = append(w.matches, found[next:]...)
+			return true
+		}
+		end += pos
+		first := next
+		for next < len(found) && found[next].Pos <= base + end {
+			next++
+		}
+		l, matches := line{w.number, base + pos, chunk[pos:end]}, found[first:next]
+		if (len(w.partial) > 0) { //the line began in an earlier chunk
+			l.start, l.text = w.start, string(append(w.partial, l.text...))
+			matches = append(w.matches, matches...)
+			w.partial, w.matches = w.partial[:0], w.matches[:0]
+		}
+		w.add(l, matches)
+		w.number, pos = w.number + 1, end + 1
+	}
+	return !w.done
+}
+
+/**
+	Writes every occurence in 'chunk' at position 'base' of the text as file:line:col:pattern,
+	with the pattern highlighted if wanted.
+*/
+func (w *lineWriter) writeOccurences(base int, chunk string, found []Occurence) {
+	for _, o := range found {
+		w.count(chunk[w.counted - base:o.Pos - base], w.counted)
+		w.counted = o.Pos
+		if pattern := w.s.c.Patterns()[o.Pattern]; (w.s.color) {
+			fmt.Fprintf(w.s.out, "%s:%d:%d:%s%s%s\n", w.path, w.number, o.Pos - w.start + 1, highlightStart, pattern, highlightEnd)
+		} else {
+			fmt.Fprintf(w.s.out, "%s:%d:%d:%s\n", w.path, w.number, o.Pos - w.start + 1, pattern)
+		}
+	}
+	w.count(chunk[w.counted - base:], w.counted)
+	w.counted = base + len(chunk)
+	w.selected += len(found)
+}
+
+/**
+	Counts the lines of 'text' at position 'pos' of the text.
+*/
+func (w *lineWriter) count(text string, pos int) {
+	w.number += strings.Count(text, "\n")
+	if i := strings.LastIndexByte(text, '\n'); (i >= 0) {
+		w.start = pos + i + 1
+	}
+}
+
+/**
+	Selects, writes or keeps as context line 'l' with occurences 'matches' starting on it.
+*/
+func (w *lineWriter) add(l line, matches []Occurence) {
+	s := w.s
+	if ((len(matches) > 0) == s.invert) { //not selected, may be a context line
+		if (w.after > 0) {
+			w.writeLine('-', l, nil)
+			w.last, w.after = l.number, w.after - 1
+		} else if (s.before > 0) {
+			if (len(w.before) == s.before) {
+				w.before = w.before[1:]
+			}
+			w.before = append(w.before, l)
+		}
+		return
+	}
+	w.selected++
+	if (s.names) {
+		fmt.Fprintln(s.out, w.path)
+		w.done = true
+		return
+	}
+	if (s.count) {
+		return
+	}
+	if from := l.number - len(w.before); (s.before + s.after > 0 && w.last > 0 && from > w.last + 1) {
+		fmt.Fprintln(s.out, "--") //separates groups of lines that are not adjacent
+	}
+	for _, b := range w.before {
+		w.writeLine('-', b, nil)
+	}
+	w.before = w.before[:0]
+	w.writeLine(':', l, matches)
+	w.last, w.after = l.number, s.after
+}
+
+/**
+	Writes the last line, unless it ended with a newline, and the count with -c.
+*/
+func (w *lineWriter) finish() {
+	if (w.s.lines && len(w.partial) > 0 && !w.done) {
+		w.add(line{w.number, w.start, string(w.partial)}, w.matches)
+	}
+	if (w.s.count) {
+		fmt.Fprintf(w.s.out, "%s:%d\n", w.path, w.selected)
+	}
+	if (w.selected > 0) {
+		w.s.found = true
+	}
+}
+
+/**
+	Writes line 'l' as file, line number and the line separated by 'separator'
+	(':' for selected lines, '-' for context), with 'matches' starting on the line highlighted if wanted.
+*/
+func (w *lineWriter) writeLine(separator byte, l line, matches []Occurence) {
+	out, patterns := w.s.out, w.s.c.Patterns()
+	fmt.Fprintf(out, "%s%c%d%c", w.path, separator, l.number, separator)
+	written := 0
+	for i := 0; w.s.color && i < len(matches); {
+		from, to := matches[i].Pos - l.start, matches[i].Pos - l.start + len(patterns[matches[i].Pattern])
+		for i++; i < len(matches) && matches[i].Pos - l.start <= to; i++ { //overlapping matches are highlighted together
+			if end := matches[i].Pos - l.start + len(patterns[matches[i].Pattern]); (end > to) {
+				to = end
+			}
+		}
+		if (to > len(l.text)) {
+			to = len(l.text)
+		}
+		if (from < to) {
+			io.WriteString(out, l.text[written:from])
+			io.WriteString(out, highlightStart)
+			io.WriteString(out, l.text[from:to])
+			io.WriteString(out, highlightEnd)
+			written = to
+		}
+	}
+	io.WriteString(out, l.text[written:])
+	io.WriteString(out, "\n")
+}
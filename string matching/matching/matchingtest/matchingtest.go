@@ -0,0 +1,641 @@
+/**
+	Package matchingtest holds what the tests of all the string matching programs share: cases easy to get wrong,
+	the search by strings.Index they are compared with, random texts, a counting tracer, benchmark corpora
+	and the checks run by every program. A program's test only describes its algorithm by an Algorithm
+	and calls the checks from its Test functions.
+	Every program imports it as "stringmatching/matching/matchingtest".
+*/
+package matchingtest
+
+import ("testing"; "strings"; "math/rand"; "reflect"; "io"; "io/ioutil"; "path/filepath"; "bytes"; "encoding/json"; "encoding/binary"; "hash/crc32"; "stringmatching/matching")
+
+/*******************          Algorithm functions          *******************/
+
+/**
+	Algorithm of a program as the checks see it, 'C' is its compiled matcher.
+
+	@field 'Name' name of the search function, in messages
+	@field 'Set' the algorithm searches for a set of patterns, not for one
+	@field 'Search' builds the matcher of 'patterns' and searches 'text' as the program does, occurences keyed
+	by pattern number (one pattern is number 0, see Found)
+	@field 'Trace' tracer of the program, set by the checks of traces and reset to nil after them
+	@field 'Comparisons' the trace reports every comparison counted in the statistics
+	@field 'States' the trace reports every state and transition counted in the statistics
+	@field 'Algorithm' number of the algorithm in SMAT files
+	@field 'Compile', 'Write', 'Read', 'LoadOrCompile' compile, save and load the matcher of 'patterns'
+	@field 'Compiled' returns search of a compiled matcher, its 'Overlap' and 'Patterns' are those the matcher was compiled for
+	@field 'EmptyPatterns' the compiled matcher may have empty patterns
+	@field 'Verifies' occurences found by a matcher are compared with its patterns, so a made up matcher finds only real occurences
+*/
+type Algorithm[C any] struct {
+	Name string
+	Set bool
+	Search func(text string, patterns []string, st *matching.Stats) map[int][]int
+	Trace *matching.Tracer
+	Comparisons, States bool
+	Algorithm uint8
+	Compile func(patterns []string) C
+	Write func(w io.Writer, c C) error
+	Read func(r io.Reader) (C, error)
+	LoadOrCompile func(path string, patterns []string) (C, error)
+	Compiled func(c C) matching.Search
+	Overlap func(c C) int
+	Patterns func(c C) []string
+	EmptyPatterns, Verifies bool
+}
+
+/**
+	Returns occurences 'positions' of a single pattern keyed as by an algorithm for more patterns,
+	pattern 0 is left out if it was not found.
+*/
+func Found(positions []int) map[int][]int {
+	found := make(map[int][]int)
+	if len(positions) > 0 {
+		found[0] = positions
+	}
+	return found
+}
+
+/**
+	Returns matching.Search of the compiled matcher of one pattern, keyed by Found.
+*/
+func Single(search func(text string, st *matching.Stats) []int) matching.Search {
+	return func(text string, st *matching.Stats) map[int][]int {
+		return Found(search(text, st))
+	}
+}
+
+/**
+	Positions of all (also overlapping) occurences of each pattern of 'p' in 't' found by strings.Index.
+	Keys are pattern indexes, patterns without occurences (and empty patterns) are left out.
+*/
+func BruteForce(t string, p []string) (occurences map[int][]int) {
+	occurences = make(map[int][]int)
+	for i := range p {
+		if len(p[i]) == 0 {
+			continue
+		}
+		for pos := 0; pos <= len(t) - len(p[i]); pos++ {
+			j := strings.Index(t[pos:], p[i])
+			if j == -1 {
+				break
+			}
+			pos += j
+			occurences[i] = append(occurences[i], pos)
+		}
+	}
+	return occurences
+}
+
+func RandomString(r *rand.Rand, alphabet string, length int) string {
+	s := make([]uint8, length)
+	for i := range s {
+		s[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(s)
+}
+
+func AllBytes() string {
+	s := make([]uint8, 256)
+	for i := range s {
+		s[i] = uint8(i)
+	}
+	return string(s)
+}
+
+/*******************          Search functions          *******************/
+
+/**
+	Text with patterns searched in it.
+*/
+type Case struct {
+	Text string
+	Patterns []string
+}
+
+/**
+	Texts and one pattern, which are easy to get wrong: empty, equal, overlapping, repetitive, binary.
+*/
+var Cases = []Case {
+	{"", []string{""}},
+	{"abc", []string{""}},
+	{"", []string{"a"}},
+	{"a", []string{"a"}},
+	{"a", []string{"b"}},
+	{"abc", []string{"abc"}},
+	{"abc", []string{"abcd"}},
+	{"aaaaaa", []string{"a"}},
+	{"aaaaaa", []string{"aa"}},
+	{"aaaaaa", []string{"aaa"}},
+	{"abababab", []string{"abab"}},
+	{"aabaabaaab", []string{"aab"}},
+	{"abcabcabd", []string{"abcabd"}},
+	{"abacabadabacaba", []string{"abacaba"}},
+	{"CPM_annual_conference_announce", []string{"announce"}},
+	{"xxxxxxxxxxxxxy", []string{"xxxy"}},
+	{"yxxxxxxxxxxxxx", []string{"yxxx"}},
+	{"\x00\xff\x80\x00\xff", []string{"\x00\xff"}},
+	{"ščšč", []string{"čš"}},
+}
+
+/**
+	Texts and sets of patterns, which are easy to get wrong: empty, equal to the text,
+	overlapping, nested, duplicate, repetitive, binary.
+*/
+var SetCases = []Case {
+	{"", []string{""}},
+	{"abc", []string{""}},
+	{"abc", []string{"", "b", ""}},
+	{"", []string{"a"}},
+	{"abc", []string{"abc"}},
+	{"abc", []string{"abcd", "c"}},
+	{"aaaaaa", []string{"a", "aa", "aaa"}},
+	{"ushers", []string{"he", "she", "his", "hers"}},
+	{"abcd", []string{"abcd", "bc", "c"}},
+	{"abcd", []string{"c", "bc", "abcd"}},
+	{"abab", []string{"ab", "ab", "b"}},
+	{"abababab", []string{"abab", "bab", "ba"}},
+	{"xyzabcxyz", []string{"xyz", "yz", "z", "zab", "abcx"}},
+	{"CPM_annual_conference_announce", []string{"announce", "annual", "annually"}},
+	{"\x00\xff\x80\x00\xff", []string{"\x00\xff", "\xff", "\x80\x00"}},
+	{"ščšč", []string{"čš", "š"}},
+}
+
+/**
+	Returns the cases of the algorithm, Cases or SetCases.
+*/
+func (a Algorithm[C]) Cases() []Case {
+	if a.Set {
+		return SetCases
+	}
+	return Cases
+}
+
+/**
+	Patterns compiled by the checks of compiled matchers and other patterns to compile instead of them.
+*/
+func (a Algorithm[C]) examples() (patterns, other []string) {
+	if a.Set {
+		return []string{"he", "she", "his", "hers"}, []string{"he", "she"}
+	}
+	return []string{"abacaba"}, []string{"abab"}
+}
+
+/**
+	Searches 'text' for 'patterns' by the algorithm and compares the result with BruteForce.
+*/
+func CheckSearch[C any](t *testing.T, a Algorithm[C], text string, patterns []string) {
+	t.Helper()
+	got := a.Search(text, patterns, nil)
+	if expected := BruteForce(text, patterns); !reflect.DeepEqual(got, expected) {
+		if len(text) > 1000 {
+			text = text[:1000]+"..."
+		}
+		t.Errorf("%s(%q, %q) = %v, expected %v", a.Name, text, patterns, got, expected)
+	}
+}
+
+func CheckCases[C any](t *testing.T, a Algorithm[C]) {
+	for _, c := range a.Cases() {
+		CheckSearch(t, a, c.Text, c.Patterns)
+	}
+}
+
+/**
+	Random texts over small alphabets (many occurences) and over all bytes,
+	patterns are random or cut out of the text.
+*/
+func CheckRandom[C any](t *testing.T, a Algorithm[C]) {
+	r := rand.New(rand.NewSource(1))
+	for _, alphabet := range []string{"ab", "acgt", "abcdefghijklmnopqrstuvwxyz", AllBytes()} {
+		if !a.Set {
+			for i := 0; i < 500; i++ {
+				text := RandomString(r, alphabet, r.Intn(200))
+				pattern := RandomString(r, alphabet, 1+r.Intn(6))
+				if len(text) > 0 && r.Intn(2) == 0 {
+					begin := r.Intn(len(text))
+					pattern = text[begin:begin+1+r.Intn(len(text)-begin)]
+				}
+				CheckSearch(t, a, text, []string{pattern})
+			}
+			continue
+		}
+		for i := 0; i < 300; i++ {
+			text := RandomString(r, alphabet, r.Intn(200))
+			patterns := make([]string, 1+r.Intn(8))
+			for j := range patterns {
+				patterns[j] = RandomString(r, alphabet, r.Intn(7))
+				if len(text) > 0 && r.Intn(2) == 0 {
+					begin := r.Intn(len(text))
+					patterns[j] = text[begin:begin+1+r.Intn(min(len(text)-begin, 10))]
+				}
+			}
+			CheckSearch(t, a, text, patterns)
+		}
+	}
+}
+
+/**
+	The example and the sets used in test-results.txt, in directory 'dir' and its testdata1 to testdata4.
+	The short tests skip the long ones.
+*/
+func CheckTestdata[C any](t *testing.T, a Algorithm[C], dir string) {
+	for _, set := range []string{".", "testdata1", "testdata2", "testdata3", "testdata4"} {
+		if testing.Short() && set != "." && set != "testdata4" {
+			continue
+		}
+		patFile, err := ioutil.ReadFile(filepath.Join(dir, set, "patterns.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		textFile, err := ioutil.ReadFile(filepath.Join(dir, set, "text.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		CheckSearch(t, a, string(textFile), strings.Split(string(patFile), " "))
+	}
+}
+
+/**
+	Fuzzes the search starting from the cases. Patterns of a set are separated by single spaces
+	as in patterns.txt, so some of them may be empty.
+*/
+func Fuzz[C any](f *testing.F, a Algorithm[C]) {
+	for _, c := range a.Cases() {
+		f.Add(c.Text, strings.Join(c.Patterns, " "))
+	}
+	f.Fuzz(func(t *testing.T, text, patterns string) {
+		if a.Set {
+			CheckSearch(t, a, text, strings.Split(patterns, " "))
+		} else {
+			CheckSearch(t, a, text, []string{patterns})
+		}
+	})
+}
+
+/*******************          Trace functions          *******************/
+
+/**
+	Tracer counting the events, found occurences are kept by pattern.
+*/
+type Recorder struct {
+	States, Transitions, Shifts, Shifted, Comparisons int
+	Matches map[int][]int
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{Matches: make(map[int][]int)}
+}
+
+func (r *Recorder) StateCreated(state int) { r.States++ }
+func (r *Recorder) TransitionAdded(from int, over uint8, to int) { r.Transitions++ }
+func (r *Recorder) WindowMoved(pos, shift int) { r.Shifts++; r.Shifted += shift }
+func (r *Recorder) Compared(pos int, c uint8, state, next int) { r.Comparisons++ }
+func (r *Recorder) MatchFound(pattern, pos int) { r.Matches[pattern] = append(r.Matches[pattern], pos) }
+
+/**
+	Events of the trace have to agree with the statistics and with the found occurences.
+*/
+func CheckTrace[C any](t *testing.T, a Algorithm[C]) {
+	defer func() { *a.Trace = nil }()
+	for _, c := range a.Cases() {
+		r := NewRecorder()
+		st := &matching.Stats{}
+		*a.Trace = r
+		got := a.Search(c.Text, c.Patterns, st)
+		*a.Trace = nil
+		if !reflect.DeepEqual(r.Matches, got) {
+			t.Errorf("%q, %q: trace found %v, search %v", c.Text, c.Patterns, r.Matches, got)
+		}
+		if r.Shifts != st.Shifts || r.Shifted != st.Shifted ||
+			(a.Comparisons && r.Comparisons != st.Comparisons) ||
+			(a.States && (r.States != st.States || r.Transitions != st.Transitions)) {
+			t.Errorf("%q, %q: trace %+v does not agree with statistics %+v", c.Text, c.Patterns, *r, *st)
+		}
+	}
+}
+
+/**
+	Every line of the JSON trace is one JSON object with its event.
+*/
+func CheckJSONTrace[C any](t *testing.T, a Algorithm[C]) {
+	var output bytes.Buffer
+	defer func() { *a.Trace = nil }()
+	var c Case
+	for _, c = range a.Cases() {
+		if c.Text == "CPM_annual_conference_announce" {
+			break
+		}
+	}
+	tr, err := matching.NewTracer("json", &output, c.Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*a.Trace = tr
+	got := a.Search(c.Text, c.Patterns, nil)
+	*a.Trace = nil
+	events := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		events[e["event"].(string)]++
+	}
+	found := 0
+	for _, positions := range got {
+		found += len(positions)
+	}
+	if events["matchFound"] != found || events["compared"] == 0 {
+		t.Errorf("wrong events %v", events)
+	}
+	if _, err := matching.NewTracer("xml", &output, c.Text); err == nil {
+		t.Errorf("unknown trace mode accepted")
+	}
+}
+
+/**
+	Exported graph 'g' highlighted by a search has all states and edges, final states and the highlighted path,
+	and its DOT or Mermaid contains 'expected'.
+*/
+func CheckGraph(t *testing.T, g *matching.Graph, expected string) {
+	var dot, mermaid bytes.Buffer
+	g.WriteDot(&dot)
+	g.WriteMermaid(&mermaid)
+	edges := len(g.Edges)+len(g.Links)
+	if n := strings.Count(dot.String(), " -> "); n != edges {
+		t.Errorf("%d edges in DOT, expected %d:\n%s", n, edges, dot.String())
+	}
+	if n := strings.Count(mermaid.String(), "-->|")+strings.Count(mermaid.String(), "-.->"); n != edges {
+		t.Errorf("%d edges in Mermaid, expected %d:\n%s", n, edges, mermaid.String())
+	}
+	if n := strings.Count(dot.String(), "doublecircle"); n != len(g.Final) {
+		t.Errorf("%d final states in DOT, expected %d:\n%s", n, len(g.Final), dot.String())
+	}
+	if n := strings.Count(dot.String(), "color=red"); n == 0 || n != len(g.Visited)+len(g.VisitedLinks) {
+		t.Errorf("%d highlighted edges in DOT, expected %d:\n%s", n, len(g.Visited)+len(g.VisitedLinks), dot.String())
+	}
+	if !strings.Contains(dot.String(), expected) || !strings.Contains(mermaid.String(), "linkStyle ") {
+		t.Errorf("missing %s in:\n%s\n%s", expected, dot.String(), mermaid.String())
+	}
+	if label := matching.EdgeLabel([]uint8{'a', ' ', '"', 0}); label != "a ␣ 0x22 0x00" {
+		t.Errorf("edgeLabel = %q", label)
+	}
+}
+
+/*******************          Compiled functions          *******************/
+
+/**
+	Returns whether the compiled matcher can have 'patterns'.
+*/
+func (a Algorithm[C]) compiles(patterns []string) bool {
+	if a.EmptyPatterns {
+		return true
+	}
+	for _, p := range patterns {
+		if len(p) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+	Compiled matchers of all cases are read back the same and find the same occurences.
+	Every damaged byte, shorter file or other version is refused.
+*/
+func CheckCompiled[C any](t *testing.T, a Algorithm[C]) {
+	for _, c := range a.Cases() {
+		if !a.compiles(c.Patterns) {
+			continue
+		}
+		compiled := a.Compile(c.Patterns)
+		var file bytes.Buffer
+		if err := a.Write(&file, compiled); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := a.Read(bytes.NewReader(file.Bytes()))
+		if err != nil {
+			t.Fatalf("%q: %v", c.Patterns, err)
+		}
+		if !reflect.DeepEqual(loaded, compiled) {
+			t.Errorf("%q: read %+v, written %+v", c.Patterns, loaded, compiled)
+		}
+		if got, expected := a.Compiled(loaded)(c.Text, nil), BruteForce(c.Text, c.Patterns); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q, %q: loaded matcher found %v, expected %v", c.Text, c.Patterns, got, expected)
+		}
+	}
+	example, _ := a.examples()
+	var file bytes.Buffer
+	a.Write(&file, a.Compile(example))
+	data := file.Bytes()
+	for i := range data {
+		damaged := append([]byte(nil), data...)
+		damaged[i] ^= 0xff
+		if _, err := a.Read(bytes.NewReader(damaged)); err == nil {
+			t.Errorf("damaged byte %d accepted", i)
+		}
+		if _, err := a.Read(bytes.NewReader(data[:i])); err == nil {
+			t.Errorf("first %d bytes accepted", i)
+		}
+	}
+	payload, _ := matching.Unseal(a.Algorithm, data)
+	other := append([]byte(matching.Magic), matching.Version + 1, a.Algorithm)
+	other = append(other, payload...)
+	other = binary.LittleEndian.AppendUint32(other, crc32.ChecksumIEEE(other))
+	if _, err := a.Read(bytes.NewReader(other)); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("other version accepted (%v)", err)
+	}
+}
+
+/**
+	File is created by the first load, reused by the second and rebuilt for other patterns.
+*/
+func CheckLoadOrCompile[C any](t *testing.T, a Algorithm[C]) {
+	example, otherExample := a.examples()
+	path := filepath.Join(t.TempDir(), "automaton.bin")
+	first, err := a.LoadOrCompile(path, example)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := a.LoadOrCompile(path, example)
+	if err != nil || !reflect.DeepEqual(first, second) {
+		t.Errorf("loaded %+v (%v), compiled %+v", second, err, first)
+	}
+	other, err := a.LoadOrCompile(path, otherExample)
+	if err != nil || reflect.DeepEqual(first, other) {
+		t.Errorf("matcher was not rebuilt (%v)", err)
+	}
+	ioutil.WriteFile(path, []byte("garbage"), 0644)
+	if _, err := a.LoadOrCompile(path, example); err == nil {
+		t.Errorf("garbage accepted")
+	}
+}
+
+/**
+	Fuzzes reading of compiled matchers starting from those of the cases. Any data with a valid header
+	and checksum is either refused or searches without crashing; if the algorithm verifies occurences,
+	it finds only real ones.
+*/
+func FuzzCompiled[C any](f *testing.F, a Algorithm[C]) {
+	for _, c := range a.Cases() {
+		if !a.compiles(c.Patterns) {
+			continue
+		}
+		var file bytes.Buffer
+		a.Write(&file, a.Compile(c.Patterns))
+		payload, _ := matching.Unseal(a.Algorithm, file.Bytes())
+		f.Add(payload, c.Text)
+	}
+	f.Fuzz(func(t *testing.T, payload []byte, text string) {
+		loaded, err := a.Read(bytes.NewReader(matching.Seal(a.Algorithm, payload)))
+		if err != nil {
+			return
+		}
+		found, patterns := a.Compiled(loaded)(text, nil), a.Patterns(loaded)
+		if !a.Verifies {
+			return
+		}
+		for i, positions := range found {
+			for _, pos := range positions {
+				if pos < 0 || pos+len(patterns[i]) > len(text) || text[pos:pos+len(patterns[i])] != patterns[i] {
+					t.Errorf("%q: no occurence of %q at %d", text, patterns[i], pos)
+				}
+			}
+		}
+	})
+}
+
+/**
+	Chunks shorter and longer than the patterns searched on several goroutines find the same occurences
+	of every pattern as the sequential search; a single chunk counts the same statistics.
+*/
+func CheckParallel[C any](t *testing.T, a Algorithm[C]) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		text := RandomString(r, "ab", r.Intn(200))
+		var patterns []string
+		if a.Set {
+			for j := 1 + r.Intn(4); j > 0; j-- {
+				patterns = append(patterns, RandomString(r, "ab", 1 + r.Intn(6)))
+			}
+		} else {
+			patterns = []string{RandomString(r, "ab", 1 + r.Intn(6))}
+		}
+		c := a.Compile(patterns)
+		sequential := &matching.Stats{}
+		expected := a.Compiled(c)(text, sequential)
+		for _, size := range []int{1, 2, 5, 64, 1000} {
+			st := &matching.Stats{}
+			found := matching.SearchParallel(text, a.Overlap(c), size, 3, st, a.Compiled(c))
+			if !reflect.DeepEqual(found, expected) {
+				t.Fatalf("%q in %q by chunks of %d: %v, expected %v", patterns, text, size, found, expected)
+			}
+			if size >= len(text) && *st != *sequential {
+				t.Errorf("%q in %q: statistics %+v, expected %+v", patterns, text, *st, *sequential)
+			}
+		}
+	}
+}
+
+/**
+	The pattern set is built by 'newPatternSet' of the program and finds what BruteForce finds
+	(see the tests of package matching for changes during searches).
+*/
+func CheckPatternSet(t *testing.T, newPatternSet func(patterns []string) (*matching.PatternSet, error)) {
+	ps, err := newPatternSet([]string{"he", "she"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Update([]string{"hers", "his"}, []string{"he"})
+	ps.Wait()
+	text := RandomString(rand.New(rand.NewSource(1)), "ehirsu", 2000)
+	if m, found := ps.Search(text, nil); !reflect.DeepEqual(m.Patterns(), []string{"she", "hers", "his"}) || !reflect.DeepEqual(found, BruteForce(text, m.Patterns())) {
+		t.Errorf("found %v of %q", found, m.Patterns())
+	}
+}
+
+/*******************          Benchmark functions          *******************/
+
+/**
+	Text searched by the benchmarks and patterns occuring in it.
+*/
+type Corpus struct {
+	Name, Text string
+	Patterns []string
+}
+
+/**
+	The four testdata sets of directory 'dir' and synthetic texts of 64 KiB with 100 patterns cut out of them:
+	DNA, English words, random bytes and a highly repetitive text. The seed is fixed,
+	so the synthetic corpora are always the same.
+*/
+func BenchmarkCorpora(b *testing.B, dir string) (corpora []Corpus) {
+	for _, set := range []string{"testdata1", "testdata2", "testdata3", "testdata4"} {
+		patFile, err := ioutil.ReadFile(filepath.Join(dir, set, "patterns.txt"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		textFile, err := ioutil.ReadFile(filepath.Join(dir, set, "text.txt"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		corpora = append(corpora, Corpus{set, string(textFile), strings.Split(string(patFile), " ")})
+	}
+	r := rand.New(rand.NewSource(1))
+	size := 1 << 16
+	words := strings.Fields("the of and to a in is you that it he was for on are as with his they I at be this have from or one had by word but not what all were we when your can said there use an each which she do how their if will up other about out many then them these so some her would make like him into time has look two more write go see number no way could people my than first water been call who oil its now find long down day did get come made may part")
+	var english []string
+	for length := 0; length < size; length += len(english[len(english)-1]) + 1 {
+		english = append(english, words[r.Intn(len(words))])
+	}
+	for _, c := range []Corpus{
+		{Name: "dna", Text: RandomString(r, "acgt", size)},
+		{Name: "english", Text: strings.Join(english, " ")[:size]},
+		{Name: "random", Text: RandomString(r, AllBytes(), size)},
+		{Name: "repetitive", Text: strings.Repeat("a", size)},
+	} {
+		for i := 0; i < 100; i++ {
+			begin := r.Intn(size - 16)
+			c.Patterns = append(c.Patterns, c.Text[begin:begin+4+r.Intn(13)])
+		}
+		corpora = append(corpora, c)
+	}
+	return corpora
+}
+
+/**
+	Reports average time spent on one byte of text of length 'n'.
+*/
+func ReportPerByte(b *testing.B, n int) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(n), "ns/byte")
+}
+
+/**
+	Measures separately building by 'build' and searching the text by the search it returns, for the corpora
+	of BenchmarkCorpora(b, dir); an algorithm for one pattern gets the first pattern of each corpus.
+	Names of the benchmarks are "<corpus>/build" and "<corpus>/search", as benchtable.go reads them.
+*/
+func Benchmark[C any](b *testing.B, a Algorithm[C], dir string, build func(text string, patterns []string) (search func())) {
+	for _, c := range BenchmarkCorpora(b, dir) {
+		patterns := c.Patterns
+		if !a.Set {
+			patterns = patterns[:1]
+		}
+		b.Run(c.Name+"/build", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				build(c.Text, patterns)
+			}
+		})
+		search := build(c.Text, patterns)
+		b.Run(c.Name+"/search", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(c.Text)))
+			for i := 0; i < b.N; i++ {
+				search()
+			}
+			ReportPerByte(b, len(c.Text))
+		})
+	}
+}
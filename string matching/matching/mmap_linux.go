@@ -0,0 +1,21 @@
+//go:build linux
+
+package matching
+
+import ("os"; "syscall")
+
+/**
+	Maps the whole file read-only. The pages are loaded from the page cache as the search reaches them
+	and may be dropped again, so no memory proportional to the size of the file is taken from the heap.
+	The file must not be truncated while it is mapped.
+	@param f regular file
+	@param size size of the file in bytes
+*/
+func mapFile(f *os.File, size int) ([]byte, func() error, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
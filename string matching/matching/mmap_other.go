@@ -0,0 +1,12 @@
+//go:build !linux
+
+package matching
+
+import ("errors"; "os")
+
+/**
+	Files are not mapped on other systems, they are read whole or streamed instead.
+*/
+func mapFile(f *os.File, size int) ([]byte, func() error, error) {
+	return nil, nil, errors.New("mapping files is supported on Linux only")
+}
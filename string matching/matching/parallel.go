@@ -0,0 +1,124 @@
+package matching
+
+import ("runtime"; "sync")
+
+/**
+	Searches 'text' (or a chunk of it) and returns positions of occurences in increasing order
+	for every pattern found, keyed by the number of the pattern (0 if there is only one).
+	It must only read the matcher, so that goroutines can share it.
+	@param st statistics to be filled, nil if not wanted
+*/
+type Search func(text string, st *Stats) map[int][]int
+
+/**
+	Returns Search of an algorithm for one pattern, its occurences are those of pattern 0.
+*/
+func Single(search func(text string, st *Stats) []int) Search {
+	return func(text string, st *Stats) map[int][]int {
+		return map[int][]int{0: search(text, st)}
+	}
+}
+
+/**
+	Chunks of the text per goroutine, more of them even out goroutines when some chunks take longer.
+*/
+const chunksPerWorker = 4
+
+/**
+	Smallest chunk worth handing to a goroutine.
+*/
+const minChunkSize = 1 << 16
+
+/**
+	Number of goroutines searching according to 'workers' (as the constant of the programs: 0 for all CPU cores),
+	1 while tracing, because events would interleave.
+*/
+func Workers(workers int, tracing bool) int {
+	if (tracing || workers == 1) {
+		return 1
+	}
+	if (workers <= 0) {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+/**
+	Size of chunks for 'n' characters of text searched by 'workers' goroutines,
+	kept a few times longer than the 'overlap' so that little of the text is searched twice.
+*/
+func ChunkSize(n, overlap, workers int) int {
+	size := n / (workers * chunksPerWorker) + 1
+	if (size < minChunkSize) {
+		size = minChunkSize
+	}
+	if (size < 4 * overlap) {
+		size = 4 * overlap
+	}
+	return size
+}
+
+/**
+	Searches 'text' with 'search', in chunks on 'workers' goroutines unless it is 1.
+	@param overlap characters by which the chunks must overlap, the length of the longest pattern - 1
+*/
+func SearchText(text string, overlap, workers int, st *Stats, search Search) map[int][]int {
+	if (workers == 1) {
+		return search(text, st)
+	}
+	return SearchParallel(text, overlap, ChunkSize(len(text), overlap, workers), workers, st, search)
+}
+
+/**
+	Searches 'text' split into chunks of 'size' characters on 'workers' goroutines.
+	Every chunk is extended by 'overlap' characters (length of the longest pattern - 1) of the next one, so each occurence
+	lies whole in the chunk it starts in; occurences starting in the extension are dropped, the next chunk finds them too.
+	@param st statistics summed over all chunks, nil if not wanted
+	@return occurences positions in text for every pattern found, in increasing order
+*/
+func SearchParallel(text string, overlap, size, workers int, st *Stats, search Search) (occurences map[int][]int) {
+	chunks := (len(text) + size - 1) / size
+	found := make([]map[int][]int, chunks)
+	counted := make([]Stats, chunks)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start, end := i * size, (i + 1) * size + overlap
+				if (end > len(text)) {
+					end = len(text)
+				}
+				var chunkStats *Stats
+				if (st != nil) {
+					chunkStats = &counted[i]
+				}
+				found[i] = make(map[int][]int)
+				for key, positions := range search(text[start:end], chunkStats) {
+					for _, pos := range positions {
+						if (pos < size) {
+							found[i][key] = append(found[i][key], start + pos)
+						}
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < chunks; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	occurences = make(map[int][]int)
+	for i := range found {
+		for key, positions := range found[i] {
+			occurences[key] = append(occurences[key], positions...)
+		}
+		if (st != nil) {
+			st.Add(&counted[i])
+		}
+	}
+	return occurences
+}
@@ -0,0 +1,91 @@
+package matching
+
+import ("math/rand"; "reflect"; "strings"; "testing")
+
+/**
+	Search by strings.Index counting one comparison per position tried, all (also overlapping) occurences of 'patterns'.
+*/
+func naiveSearch(patterns []string) Search {
+	return func(text string, st *Stats) map[int][]int {
+		occurences := make(map[int][]int)
+		for pos := 0; pos < len(text); pos++ {
+			if (st != nil) {
+				st.Comparisons++
+			}
+			for k, p := range patterns {
+				if (len(p) > 0 && strings.HasPrefix(text[pos:], p)) {
+					occurences[k] = append(occurences[k], pos)
+				}
+			}
+		}
+		return occurences
+	}
+}
+
+func randomString(r *rand.Rand, alphabet string, length int) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func longest(patterns []string) (lmax int) {
+	for _, p := range patterns {
+		if (len(p) > lmax) {
+			lmax = len(p)
+		}
+	}
+	return lmax
+}
+
+/**
+	Chunks of any size searched in parallel find the same occurences as one search of the whole text,
+	statistics of one chunk are those of the whole search.
+*/
+func TestParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		text := randomString(r, "ab", r.Intn(200))
+		var patterns []string
+		for j := 1 + r.Intn(4); j > 0; j-- {
+			patterns = append(patterns, randomString(r, "ab", 1 + r.Intn(6)))
+		}
+		search := naiveSearch(patterns)
+		sequential := &Stats{}
+		expected := search(text, sequential)
+		for _, size := range []int{1, 2, 5, 64, 1000} {
+			st := &Stats{}
+			found := SearchParallel(text, longest(patterns) - 1, size, 3, st, search)
+			if !reflect.DeepEqual(found, expected) {
+				t.Fatalf("%q in %q by chunks of %d: %v, expected %v", patterns, text, size, found, expected)
+			}
+			if size >= len(text) && *st != *sequential {
+				t.Errorf("%q in %q: statistics %+v, expected %+v", patterns, text, *st, *sequential)
+			}
+		}
+	}
+	if found := SearchParallel("", 0, 1, 2, nil, naiveSearch([]string{"a"})); len(found) != 0 {
+		t.Errorf("found %v in empty text", found)
+	}
+}
+
+/**
+	Single search of one pattern is pattern 0, the text is split only for more workers,
+	tracing searches sequentially and chunks are not much shorter than the overlap.
+*/
+func TestSearchText(t *testing.T) {
+	single := Single(func(text string, st *Stats) []int { return naiveSearch([]string{"ab"})(text, st)[0] })
+	text := strings.Repeat("abc", 100000)
+	for _, workers := range []int{1, 4} {
+		if found := SearchText(text, 1, workers, nil, single)[0]; len(found) != 100000 || found[99999] != 299997 {
+			t.Errorf("%d workers found %d occurences", workers, len(found))
+		}
+	}
+	if Workers(4, true) != 1 || Workers(1, false) != 1 || Workers(3, false) != 3 || Workers(0, false) < 1 {
+		t.Errorf("wrong number of workers")
+	}
+	if size := ChunkSize(10, 1 << 20, 4); size != 4 << 20 {
+		t.Errorf("chunk of %d characters for overlap of %d", size, 1 << 20)
+	}
+}
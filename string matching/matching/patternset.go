@@ -0,0 +1,161 @@
+package matching
+
+import ("fmt"; "sync"; "sync/atomic")
+
+/**
+	Set of patterns that can be changed while it is being searched with (like a blocklist).
+	A change only edits the list of patterns and returns at once: a goroutine builds the matcher of the new list
+	aside (the second buffer) and swaps it in atomically, changes made while it builds are built together by
+	its next round, so a burst of changes costs one or two builds instead of one each. A search uses the snapshot
+	current when it starts, which is never changed, so searches neither wait for changes nor see half of one.
+*/
+type PatternSet struct {
+	compile func(patterns []string) Matcher
+	semantics Semantics
+	workers int
+	current atomic.Pointer[snapshot]
+	mu sync.Mutex //guards the fields below
+	built *sync.Cond //signalled when a snapshot is swapped in
+	patterns []string //patterns of the last change, not built yet if generation is ahead of the snapshot
+	generation int //number of changes
+	building bool //the builder goroutine is running
+}
+
+/**
+	Matcher built for the patterns of change number 'generation', never changed.
+*/
+type snapshot struct {
+	matcher Matcher
+	generation int
+}
+
+/**
+	Returns set of the non-empty 'patterns', duplicates are kept once. The first matcher is built before it returns.
+	@param compile builds matcher of the patterns, called by one goroutine at a time
+	@param semantics selects occurences found by Search
+	@param workers goroutines searching chunks of a text, see SearchText
+*/
+func NewPatternSet(patterns []string, compile func(patterns []string) Matcher, semantics Semantics, workers int) (*PatternSet, error) {
+	if err := checkPatterns(patterns); (err != nil) {
+		return nil, err
+	}
+	ps := &PatternSet{compile: compile, semantics: semantics, workers: workers}
+	ps.built = sync.NewCond(&ps.mu)
+	ps.patterns = merge(nil, patterns, nil)
+	ps.current.Store(&snapshot{compile(ps.patterns), 0})
+	return ps, nil
+}
+
+/**
+	Returns error if any of 'patterns' is empty.
+*/
+func checkPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if (len(pattern) == 0) {
+			return fmt.Errorf("empty pattern would be found everywhere")
+		}
+	}
+	return nil
+}
+
+/**
+	Returns 'patterns' without 'removed', followed by 'added' that are not among them yet, as a new list.
+*/
+func merge(patterns, added, removed []string) (merged []string) {
+	drop, kept := make(map[string]bool), make(map[string]bool)
+	for _, pattern := range removed {
+		drop[pattern] = true
+	}
+	for _, pattern := range patterns {
+		if (!drop[pattern] && !kept[pattern]) {
+			merged, kept[pattern] = append(merged, pattern), true
+		}
+	}
+	for _, pattern := range added {
+		if (!kept[pattern]) {
+			merged, kept[pattern] = append(merged, pattern), true
+		}
+	}
+	return merged
+}
+
+/**
+	Returns the matcher of the current snapshot. It stays the same however the set changes,
+	positions found by it refer to its own patterns.
+*/
+func (ps *PatternSet) Snapshot() Matcher {
+	return ps.current.Load().matcher
+}
+
+/**
+	Searches 'text' with the current snapshot, returns the snapshot with occurences of its patterns.
+*/
+func (ps *PatternSet) Search(text string, st *Stats) (Matcher, map[int][]int) {
+	m := ps.Snapshot()
+	return m, SelectMatches(SearchText(text, m.Overlap(), ps.workers, st, m.Search), m.Patterns(), ps.semantics)
+}
+
+/**
+	Adds pattern 'pattern' unless it is already in the set.
+*/
+func (ps *PatternSet) Add(pattern string) error {
+	return ps.Update([]string{pattern}, nil)
+}
+
+/**
+	Removes pattern 'pattern' if it is in the set.
+*/
+func (ps *PatternSet) Remove(pattern string) error {
+	return ps.Update(nil, []string{pattern})
+}
+
+/**
+	Removes patterns 'removed', then adds 'added' (after the patterns kept, in their order) as one change.
+	It returns without waiting for the new matcher, searches go on with the previous snapshot until it is built
+	(see Wait).
+*/
+func (ps *PatternSet) Update(added, removed []string) error {
+	if err := checkPatterns(added); (err != nil) {
+		return err
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	patterns := merge(ps.patterns, added, removed)
+	if (SamePatterns(patterns, ps.patterns)) {
+		return nil
+	}
+	ps.patterns, ps.generation = patterns, ps.generation + 1
+	if (!ps.building) {
+		ps.building = true
+		go ps.build()
+	}
+	return nil
+}
+
+/**
+	Builds matchers of the latest patterns until the snapshot includes every change.
+*/
+func (ps *PatternSet) build() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for ps.current.Load().generation < ps.generation {
+		patterns, generation := ps.patterns, ps.generation //the list is replaced by changes, never modified
+		ps.mu.Unlock()
+		m := ps.compile(patterns)
+		ps.current.Store(&snapshot{m, generation})
+		ps.mu.Lock()
+		ps.built.Broadcast()
+	}
+	ps.building = false
+}
+
+/**
+	Waits until the snapshot includes all changes made before.
+*/
+func (ps *PatternSet) Wait() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for generation := ps.generation; ps.current.Load().generation < generation; {
+		ps.built.Wait()
+	}
+}
@@ -0,0 +1,108 @@
+package matching
+
+import ("math/rand"; "reflect"; "sync"; "testing")
+
+/**
+	Patterns are added and removed in order and once; a snapshot keeps finding its own patterns
+	while goroutines search and the set changes.
+*/
+func TestPatternSet(t *testing.T) {
+	ps, err := NewPatternSet([]string{"he", "she", "he"}, compileNaive, AllOccurences, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := ps.Snapshot()
+	if err := ps.Update([]string{"hers", "his", "she"}, []string{"he"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Add(""); err == nil {
+		t.Errorf("empty pattern added")
+	}
+	if _, err := NewPatternSet([]string{"he", ""}, compileNaive, AllOccurences, 1); err == nil {
+		t.Errorf("set with an empty pattern created")
+	}
+	ps.Wait()
+	if !reflect.DeepEqual(old.Patterns(), []string{"he", "she"}) || !reflect.DeepEqual(ps.Snapshot().Patterns(), []string{"she", "hers", "his"}) {
+		t.Fatalf("patterns %q, then %q", old.Patterns(), ps.Snapshot().Patterns())
+	}
+	if found := old.Search("ushers", nil); !reflect.DeepEqual(found, map[int][]int{0: {2}, 1: {1}}) {
+		t.Errorf("old snapshot found %v", found)
+	}
+	ps.Remove("she")
+	ps.Wait()
+	if m, found := ps.Search("ushers", nil); !reflect.DeepEqual(m.Patterns(), []string{"hers", "his"}) || !reflect.DeepEqual(found, map[int][]int{0: {2}}) {
+		t.Errorf("found %v of %q", found, m.Patterns())
+	}
+	r := rand.New(rand.NewSource(1))
+	text := randomString(r, "abc", 2000)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m, found := ps.Search(text, nil)
+				if expected := naiveSearch(m.Patterns())(text, nil); !reflect.DeepEqual(found, expected) {
+					t.Errorf("snapshot of %q found %v, expected %v", m.Patterns(), found, expected)
+					return
+				}
+			}
+		}()
+	}
+	patterns := ps.Snapshot().Patterns()
+	for i := 0; i < 100; i++ {
+		added, removed := []string{randomString(r, "abc", 1 + r.Intn(4))}, []string{randomString(r, "abc", 1 + r.Intn(4))}
+		ps.Update(added, removed)
+		patterns = merge(patterns, added, removed)
+	}
+	wg.Wait()
+	ps.Wait()
+	if !reflect.DeepEqual(ps.Snapshot().Patterns(), patterns) {
+		t.Errorf("built %q, expected %q", ps.Snapshot().Patterns(), patterns)
+	}
+}
+
+/**
+	Changes return while a matcher is being built, searches meanwhile use the previous snapshot,
+	and changes made during a build are built together.
+*/
+func TestPatternSetBuildsAside(t *testing.T) {
+	release, started := make(chan bool), make(chan bool)
+	var mu sync.Mutex
+	builds := 0
+	compile := func(patterns []string) Matcher {
+		mu.Lock()
+		builds++
+		blocked := builds > 1
+		mu.Unlock()
+		if (blocked) {
+			started <- true
+			<-release
+		}
+		return naiveMatcher(patterns)
+	}
+	ps, err := NewPatternSet([]string{"he"}, compile, LeftmostLongest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.Add("she")
+	<-started //building {"he", "she"}
+	for _, pattern := range []string{"his", "hers", "her"} {
+		ps.Add(pattern) //returns although the build is blocked
+	}
+	if m, found := ps.Search("ushers", nil); !reflect.DeepEqual(m.Patterns(), []string{"he"}) || !reflect.DeepEqual(found, map[int][]int{0: {2}}) {
+		t.Errorf("search during the build found %v of %q", found, m.Patterns())
+	}
+	release <- true
+	<-started //building all the changes made meanwhile at once
+	release <- true
+	ps.Wait()
+	if m, found := ps.Search("ushers", nil); !reflect.DeepEqual(m.Patterns(), []string{"he", "she", "his", "hers", "her"}) || !reflect.DeepEqual(found, map[int][]int{1: {1}}) {
+		t.Errorf("found %v of %q", found, m.Patterns())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if (builds != 3) {
+		t.Errorf("%d builds, expected 3", builds)
+	}
+}
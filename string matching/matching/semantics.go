@@ -0,0 +1,97 @@
+package matching
+
+import "sort"
+
+/**
+	Which occurences a search reports.
+*/
+type Semantics int
+
+const (
+	AllOccurences Semantics = iota //every occurence, overlapping ones too
+	LeftmostFirst //the leftmost occurence, of the pattern given first where more of them start, then the next one after it
+	LeftmostLongest //the leftmost occurence, of the longest pattern where more of them start, then the next one after it
+)
+
+/**
+	Occurence of pattern number 'Pattern' at position 'Pos' of a text.
+*/
+type Occurence struct {
+	Pos, Pattern int
+}
+
+/**
+	Returns occurences of all patterns ordered by position, then by pattern.
+*/
+func SortOccurences(occurences map[int][]int) (sorted []Occurence) {
+	for pattern, positions := range occurences {
+		for _, pos := range positions {
+			sorted = append(sorted, Occurence{pos, pattern})
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if (sorted[i].Pos != sorted[j].Pos) {
+			return sorted[i].Pos < sorted[j].Pos
+		}
+		return sorted[i].Pattern < sorted[j].Pattern
+	})
+	return sorted
+}
+
+/**
+	Returns 'occurences' of patterns 'p' selected by 'semantics'. The text is scanned from the left, at the first
+	position where any pattern occurs one occurence is selected and the scan goes on after its end. Selecting from
+	all occurences keeps the results of all matchers (and of parallel search) the same.
+	@param occurences positions of every occurence of every pattern
+*/
+func SelectMatches(occurences map[int][]int, p []string, semantics Semantics) map[int][]int {
+	if (semantics == AllOccurences) {
+		return occurences
+	}
+	selected := make(map[int][]int)
+	for _, o := range NewSelector(p, semantics).Select(SortOccurences(occurences)) {
+		selected[o.Pattern] = append(selected[o.Pattern], o.Pos)
+	}
+	return selected
+}
+
+/**
+	Selects occurences by semantics as SelectMatches does, from occurences of a text coming in parts
+	(chunks of a streamed text), so it remembers where the last selected occurence ends.
+*/
+type Selector struct {
+	patterns []string
+	semantics Semantics
+	next int //first position after the last selected occurence
+}
+
+/**
+	Returns selector of occurences of 'patterns' by 'semantics'.
+*/
+func NewSelector(patterns []string, semantics Semantics) *Selector {
+	return &Selector{patterns: patterns, semantics: semantics}
+}
+
+/**
+	Returns the occurences selected from the next part 'sorted' (by SortOccurences), which lies after
+	the parts selected before. All occurences starting at one position must be in the same part.
+*/
+func (s *Selector) Select(sorted []Occurence) []Occurence {
+	if (s.semantics == AllOccurences) {
+		return sorted
+	}
+	var selected []Occurence
+	for i := 0; i < len(sorted); {
+		best := sorted[i] //the pattern given first, as sorted
+		for i++; i < len(sorted) && sorted[i].Pos == best.Pos; i++ {
+			if (s.semantics == LeftmostLongest && len(s.patterns[sorted[i].Pattern]) > len(s.patterns[best.Pattern])) {
+				best = sorted[i]
+			}
+		}
+		if (best.Pos >= s.next) {
+			selected = append(selected, best)
+			s.next = best.Pos + len(s.patterns[best.Pattern])
+		}
+	}
+	return selected
+}
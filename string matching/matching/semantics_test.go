@@ -0,0 +1,72 @@
+package matching
+
+import ("math/rand"; "reflect"; "strings"; "testing")
+
+/**
+	Selects occurences scanning the text for the first or the longest pattern at every position.
+*/
+func naiveSelect(text string, patterns []string, semantics Semantics) map[int][]int {
+	selected := make(map[int][]int)
+	for i := 0; i < len(text); {
+		best := -1
+		for k, pattern := range patterns {
+			if strings.HasPrefix(text[i:], pattern) && (best == -1 || (semantics == LeftmostLongest && len(pattern) > len(patterns[best]))) {
+				best = k
+			}
+		}
+		if best == -1 {
+			i++
+			continue
+		}
+		selected[best] = append(selected[best], i)
+		i += len(patterns[best])
+	}
+	return selected
+}
+
+/**
+	Leftmost-first and leftmost-longest select occurences that do not overlap, the same as naiveSelect,
+	also when the occurences come in chunks.
+*/
+func TestSemantics(t *testing.T) {
+	patterns, text := []string{"Sam", "Samwise", "wise", "is"}, "Samwise is wise"
+	all := naiveSearch(patterns)(text, nil)
+	if found := SelectMatches(all, patterns, AllOccurences); !reflect.DeepEqual(found, map[int][]int{0: {0}, 1: {0}, 2: {3, 11}, 3: {4, 8, 12}}) {
+		t.Errorf("all occurences: %v", found)
+	}
+	if found := SelectMatches(all, patterns, LeftmostFirst); !reflect.DeepEqual(found, map[int][]int{0: {0}, 2: {3, 11}, 3: {8}}) {
+		t.Errorf("leftmost-first: %v", found)
+	}
+	if found := SelectMatches(all, patterns, LeftmostLongest); !reflect.DeepEqual(found, map[int][]int{1: {0}, 2: {11}, 3: {8}}) {
+		t.Errorf("leftmost-longest: %v", found)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		text := randomString(r, "abc", r.Intn(100))
+		var patterns []string
+		for j := 1 + r.Intn(5); j > 0; j-- {
+			patterns = append(patterns, randomString(r, "abc", 1 + r.Intn(4)))
+		}
+		all := naiveSearch(patterns)(text, nil)
+		for _, semantics := range []Semantics{LeftmostFirst, LeftmostLongest} {
+			expected := naiveSelect(text, patterns, semantics)
+			if found := SelectMatches(all, patterns, semantics); !reflect.DeepEqual(found, expected) {
+				t.Fatalf("%q in %q by semantics %d: %v, expected %v", patterns, text, semantics, found, expected)
+			}
+			chunked, s, sorted := make(map[int][]int), NewSelector(patterns, semantics), SortOccurences(all)
+			for len(sorted) > 0 {
+				n := 1 + r.Intn(len(sorted))
+				for n < len(sorted) && sorted[n].Pos == sorted[n - 1].Pos {
+					n++
+				}
+				for _, o := range s.Select(sorted[:n]) {
+					chunked[o.Pattern] = append(chunked[o.Pattern], o.Pos)
+				}
+				sorted = sorted[n:]
+			}
+			if !reflect.DeepEqual(chunked, expected) {
+				t.Fatalf("%q in %q by semantics %d in chunks: %v, expected %v", patterns, text, semantics, chunked, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/**
+	Package matching holds what all the string matching programs share, so that it is written
+	(and tested) once: statistics, traces, export of automata, the SMAT format of compiled matchers,
+	input of texts, parallel search, file search, match semantics and pattern sets.
+	Every program imports it as "stringmatching/matching".
+*/
+package matching
+
+import ("fmt"; "runtime"; "time")
+
+/**
+	Statistics of one search, collected only if the algorithm gets a pointer to them (nil means none).
+
+	@field 'Comparisons' characters of the text read or compared with a pattern
+	@field 'Shifts' moves of the search window, 'Shifted' their total length
+	@field 'States' states of the automaton (items of the table for KMP and Horspool)
+	@field 'Transitions' transitions of the automaton
+	@field 'Memory' bytes allocated while building the automaton (or table)
+	@field 'Build' time spent on preprocessing, 'Search' time spent on searching
+*/
+type Stats struct {
+	Comparisons, Shifts, Shifted int
+	States, Transitions int
+	Memory uint64
+	Build, Search time.Duration
+}
+
+/**
+	Average length of one shift of the search window.
+*/
+func (st *Stats) AverageShift() float64 {
+	if st.Shifts == 0 {
+		return 0
+	}
+	return float64(st.Shifted)/float64(st.Shifts)
+}
+
+/**
+	Adds counts of the search of another part of the text, e.g. of a chunk searched in parallel.
+*/
+func (st *Stats) Add(other *Stats) {
+	st.Comparisons += other.Comparisons
+	st.Shifts += other.Shifts
+	st.Shifted += other.Shifted
+}
+
+/**
+	Returns the statistics as printed by the programs.
+*/
+func (st *Stats) String() string {
+	return fmt.Sprintf("Comparisons: %d\nShifts: %d (average length %.2f)\nStates: %d, transitions: %d\nMemory: %d bytes\nBuild: %f secs, search: %f secs\n",
+		st.Comparisons, st.Shifts, st.AverageShift(), st.States, st.Transitions, st.Memory, st.Build.Seconds(), st.Search.Seconds())
+}
+
+/**
+	Returns number of bytes allocated so far, difference of two calls is memory allocated in between.
+*/
+func AllocatedBytes() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.TotalAlloc
+}
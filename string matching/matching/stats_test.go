@@ -0,0 +1,22 @@
+package matching
+
+import ("strings"; "testing"; "time")
+
+/**
+	Statistics of chunks add up, the average shift does not divide by zero.
+*/
+func TestStats(t *testing.T) {
+	st := &Stats{}
+	if st.AverageShift() != 0 {
+		t.Errorf("average shift of no shifts is %f", st.AverageShift())
+	}
+	st.Add(&Stats{Comparisons: 5, Shifts: 2, Shifted: 3})
+	st.Add(&Stats{Comparisons: 1, Shifts: 2, Shifted: 5})
+	st.Build, st.Search = time.Second, time.Second / 2
+	if st.Comparisons != 6 || st.Shifts != 4 || st.AverageShift() != 2 {
+		t.Errorf("wrong sum %+v", *st)
+	}
+	if !strings.Contains(st.String(), "Shifts: 4 (average length 2.00)") || !strings.Contains(st.String(), "search: 0.500000 secs") {
+		t.Errorf("wrong statistics:\n%s", st)
+	}
+}
@@ -0,0 +1,112 @@
+package matching
+
+import ("fmt"; "io")
+
+/**
+	Hooks called by an algorithm while building and searching, only if its tracer is not nil.
+	Positions are positions in the text.
+*/
+type Tracer interface {
+	StateCreated(state int)
+	TransitionAdded(from int, over uint8, to int)
+	//window (alignment of the pattern) starts at 'pos' after moving by 'shift'
+	WindowMoved(pos, shift int)
+	//character 'c' at 'pos' was read in 'state' (number of matched characters for KMP and Horspool),
+	//'next' is the following state or -1 if the characters differ
+	Compared(pos int, c uint8, state, next int)
+	//occurence of pattern number 'pattern' (0 if there is only one) starting at 'pos'
+	MatchFound(pattern, pos int)
+}
+
+/**
+	Returns tracer for 'mode' ("text" or "json") writing to 'w', nil for "".
+	@param text searched text, printed by the text trace around every compared character
+*/
+func NewTracer(mode string, w io.Writer, text string) (Tracer, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "text":
+		return &textTracer{w: w, text: text}, nil
+	case "json":
+		return &jsonTracer{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown trace mode %q, use \"text\", \"json\" or \"\"", mode)
+}
+
+/**
+	Trace readable by people, the searched text is printed with the compared character in brackets.
+*/
+type textTracer struct {
+	w io.Writer
+	text string
+}
+
+func (tr *textTracer) StateCreated(state int) {
+	fmt.Fprintf(tr.w, "\ncreated state %d", state)
+}
+
+func (tr *textTracer) TransitionAdded(from int, over uint8, to int) {
+	fmt.Fprintf(tr.w, "\n    σ(%d,%c)=%d;", from, over, to)
+}
+
+func (tr *textTracer) WindowMoved(pos, shift int) {
+	fmt.Fprintf(tr.w, "\n\nposition %d (shift %d):", pos, shift)
+}
+
+func (tr *textTracer) Compared(pos int, c uint8, state, next int) {
+	if next == -1 {
+		fmt.Fprintf(tr.w, "\n    (%d)---(%c)       ", state, c)
+	} else {
+		fmt.Fprintf(tr.w, "\n    (%d)---(%c)--->(%d)", state, c, next)
+	}
+	if pos < len(tr.text) {
+		fmt.Fprintf(tr.w, " %s[%c]%s", tr.text[:pos], c, tr.text[pos+1:])
+	}
+	if next == -1 {
+		fmt.Fprintf(tr.w, " FAIL on the character[%c]", c)
+	}
+}
+
+func (tr *textTracer) MatchFound(pattern, pos int) {
+	fmt.Fprintf(tr.w, "\nOccurence of pattern %d at position %d", pattern, pos)
+}
+
+/**
+	Trace for other programs, one JSON object per event and line, e.g.
+	{"event":"compared","pos":3,"char":97,"state":0,"next":1}
+*/
+type jsonTracer struct {
+	w io.Writer
+}
+
+/**
+	Writes one event, 'fields' are pairs of a name and a number.
+*/
+func (tr *jsonTracer) event(name string, fields ...interface{}) {
+	line := "{\"event\":\""+name+"\""
+	for i := 0; i+1 < len(fields); i += 2 {
+		line = line+fmt.Sprintf(",%q:%d", fields[i], fields[i+1])
+	}
+	fmt.Fprintln(tr.w, line+"}")
+}
+
+func (tr *jsonTracer) StateCreated(state int) {
+	tr.event("stateCreated", "state", state)
+}
+
+func (tr *jsonTracer) TransitionAdded(from int, over uint8, to int) {
+	tr.event("transitionAdded", "from", from, "char", over, "to", to)
+}
+
+func (tr *jsonTracer) WindowMoved(pos, shift int) {
+	tr.event("windowMoved", "pos", pos, "shift", shift)
+}
+
+func (tr *jsonTracer) Compared(pos int, c uint8, state, next int) {
+	tr.event("compared", "pos", pos, "char", c, "state", state, "next", next)
+}
+
+func (tr *jsonTracer) MatchFound(pattern, pos int) {
+	tr.event("matchFound", "pattern", pattern, "pos", pos)
+}
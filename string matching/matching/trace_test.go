@@ -0,0 +1,61 @@
+package matching
+
+import ("bytes"; "encoding/json"; "strings"; "testing")
+
+/**
+	Calls every hook of 't' once, as an algorithm reading "ab" would.
+*/
+func traceEvents(t Tracer) {
+	t.StateCreated(0)
+	t.TransitionAdded(0, 'a', 1)
+	t.Compared(0, 'a', 0, 1)
+	t.Compared(1, 'b', 1, -1)
+	t.WindowMoved(1, 1)
+	t.MatchFound(2, 0)
+}
+
+/**
+	Every line of the JSON trace is one JSON object with its event and fields.
+*/
+func TestJSONTrace(t *testing.T) {
+	var output bytes.Buffer
+	tr, err := NewTracer("json", &output, "ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceEvents(tr)
+	var events []string
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		events = append(events, e["event"].(string))
+		if e["event"] == "matchFound" && (e["pattern"] != 2.0 || e["pos"] != 0.0) {
+			t.Errorf("wrong fields %v", e)
+		}
+	}
+	if strings.Join(events, " ") != "stateCreated transitionAdded compared compared windowMoved matchFound" {
+		t.Errorf("wrong events %v", events)
+	}
+}
+
+/**
+	Text trace shows the compared character in the text, other modes are refused.
+*/
+func TestTextTrace(t *testing.T) {
+	var output bytes.Buffer
+	tr, _ := NewTracer("text", &output, "ab")
+	traceEvents(tr)
+	for _, expected := range []string{"σ(0,a)=1;", "(0)---(a)--->(1) [a]b", "(1)---(b)        a[b] FAIL", "pattern 2 at position 0"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("%q missing in:\n%s", expected, output.String())
+		}
+	}
+	if tr, err := NewTracer("", &output, "ab"); tr != nil || err != nil {
+		t.Errorf("no trace expected, got %v, %v", tr, err)
+	}
+	if _, err := NewTracer("xml", &output, "ab"); err == nil {
+		t.Errorf("unknown trace mode accepted")
+	}
+}
@@ -1,13 +1,89 @@
 package main
-import ("fmt"; "log"; "strings"; "io/ioutil"; "time")
+import ("fmt"; "log"; "os"; "strings"; "io"; "io/ioutil"; "time"; "sort"; "bufio"; "flag"; "stringmatching/matching")
 
 /** 
 	User defined.
 	
-	@true prints various extra stuff out, but slows down the execution
-	@false will be quick and quiet
+	@"text" prints various extra stuff out (to stderr), but slows down the execution
+	@"json" prints the same events as JSON, one per line (to stderr)
+	@"" will be quick and quiet
 */
-const debugMode bool = true
+const traceMode string = "text"
+
+/**
+	Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+	User defined.
+
+	@"dot" writes the automaton to automaton.dot (Graphviz)
+	@"mermaid" writes it to automaton.mmd (Mermaid flowchart)
+	@"" exports nothing
+*/
+const exportFormat string = ""
+
+/**
+	User defined.
+
+	@true highlights transitions taken while searching in the text in the export
+	@false exports the automaton only
+*/
+const exportSearchPath bool = true
+
+/**
+	User defined.
+
+	@"" builds the automaton on every run
+	@"file name" loads the compiled automaton from the file, or builds it and saves it there
+	if the file does not exist yet or was built for other patterns
+*/
+const automatonFile string = ""
+
+/**
+	User defined.
+
+	@"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+	@"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+	User defined.
+
+	@1 searches the text sequentially
+	@n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+	@0 uses a goroutine for every CPU core
+	The search is sequential while tracing.
+*/
+const workers int = 1
+
+/**
+	User defined.
+
+	@false searches inputFile
+	@true searches files, globs and directories given on the command line recursively (see matching.SearchFiles),
+	printing file:line:col:pattern for every occurence
+*/
+const fileSearch bool = false
+
+/**
+	User defined.
+
+	@false searches for the patterns
+	@true rewrites the text with occurences of the patterns replaced or masked, see replaceFiles
+*/
+const replaceMode bool = false
+
+/**
+	User defined.
+
+	@matching.AllOccurences reports every occurence of every pattern, overlapping ones too
+	@matching.LeftmostFirst reports occurences that do not overlap, of the pattern given first where more of them start
+	@matching.LeftmostLongest reports occurences that do not overlap, of the longest pattern where more of them start
+*/
+const semantics matching.Semantics = matching.AllOccurences
 
 /**
  	Implementation of Basic Aho-Corasick algorithm (Prefix based).
@@ -16,93 +92,191 @@ const debugMode bool = true
 	
 	@file 'patterns.txt' containing the patterns to be searched for separated by single spaces
 	@file 'text.txt' containing the text to be searched in
+	If(fileSearch == true) searches files given on the command line instead, see searchFiles.
+	If(replaceMode == true) replaces occurences in files given on the command line, see replaceFiles.
 */
 func main() {
+	if (fileSearch == true) {
+		os.Exit(matching.SearchFiles(os.Args[1:], os.Stdout, os.Stderr, compileMatcher, semantics, matching.Workers(workers, false)))
+	}
+	if (replaceMode == true) {
+		os.Exit(replaceFiles(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
 	patFile, err := ioutil.ReadFile("patterns.txt")
 	if err != nil {
 		log.Fatal(err)
 	}
-	textFile, err := ioutil.ReadFile("text.txt")
+	in, err := matching.OpenInput(inputFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer in.Close()
+	if (traceMode != "" || exportFormat != "") { //both show the text, so a streamed one is read whole
+		if err := in.ReadAll(); err != nil {
+			log.Fatal(err)
+		}
+	}
 	patterns := strings.Split(string(patFile), " ")
 	fmt.Printf("\nRunning: Basic Aho-Corasick algorithm.\n\n")
-	if debugMode==true { 
+	setTracer(in.Text)
+	if trace != nil { 
 		fmt.Printf("Searching for %d patterns/words:\n",len(patterns))
 	}
 	for i := 0; i < len(patterns); i++ {
-		if (len(patterns[i]) > len(textFile)) {
+		if (in.Whole() && len(patterns[i]) > len(in.Text)) {
 			log.Fatal("There is a pattern that is longer than text! Pattern number:", i+1)
 		}
-		if debugMode==true { 
+		if trace != nil { 
 			fmt.Printf("%q ", patterns[i])
 		}
 	}
-	if debugMode==true { 
-		fmt.Printf("\n\nIn text (%d chars long): \n%q\n\n",len(textFile), textFile)
+	if trace != nil { 
+		fmt.Printf("\n\nIn text (%s): \n%s\n\n", in.Length(), in.Preview())
+	}
+	printResult(in, patterns)
+	export(in.Text, patterns)
+}
+
+/**
+	Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+	var err error
+	if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+		log.Fatal(err)
 	}
-	ahoCorasick(string(textFile), patterns)
+}
+
+/**
+	Exports Aho-Corasick trie of patterns 'p' with supply links and output sets according to exportFormat,
+	with transitions and links taken while searching in 't' if exportSearchPath is set.
+*/
+func export(t string, p []string) {
+	if exportFormat == "" {
+		return
+	}
+	previous := trace
+	trace = nil //construction was already traced by the search
+	ac, f, s := buildAc(p)
+	g := matching.NewGraph("Aho-Corasick automaton", ac)
+	for state := 1; state < len(s); state++ {
+		g.Links[state] = s[state]
+	}
+	g.AddOutputSets(f)
+	if exportSearchPath == true {
+		path := matching.NewSearchPath()
+		trace = path
+		searchAc(t, p, ac, f, s, nil)
+		g.Highlight(path)
+	}
+	trace = previous
+	if err := matching.ExportGraph(g, exportFormat); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Runs ahoCorasick and prints how long it took and occurences of each pattern
+	(if there was at least one) in the order of patterns, and statistics of the search.
+*/
+func printResult(in *matching.Input, p []string) {
+	startTime := time.Now()
+	st := &matching.Stats{}
+	occurences := matching.SelectMatches(runAhoCorasick(in, p, st), p, semantics)
+	elapsed := time.Since(startTime)
+	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
+	for key := range p {
+		value, ok := occurences[key]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
+		for i := range value {
+			fmt.Printf("%d", value[i])
+			if i != len(value) - 1 {
+				fmt.Printf(", ")
+			}
+		}
+		fmt.Printf(".")
+	}
+	fmt.Printf("\n\n%s", st)
 }
 
 /**
 	Function performing the Basic Aho-Corasick alghoritm. 
-	Finds and prints occurences of each pattern. 
+	Finds occurences of each pattern, empty patterns are not searched for. 
 	
 	@param t text to be searched in
 	@param p list of patterns to be serached for
+	@param st statistics to be filled, nil if not wanted
+	@return occurences map with keys of pattern indexes and values - positions in text, in increasing order
 */  
-func ahoCorasick(t string, p []string) {
-	startTime := time.Now()
-	occurences := make(map[int][]int)
-	ac, f, s := buildAc(p)
-	if debugMode==true {
-		fmt.Printf("\n\nAC:\n\n")
+func ahoCorasick(t string, p []string, st *matching.Stats) (occurences map[int][]int) {
+	if st == nil {
+		ac, f, s := buildAc(p)
+		return searchAc(t, p, ac, f, s, nil)
 	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	ac, f, s := buildAc(p)
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(ac), countTransitions(ac)
+	start = time.Now()
+	occurences = searchAc(t, p, ac, f, s, st)
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Searching part of ahoCorasick, automaton 'ac' with terminal states 'f'
+	and supply function 's' is built by buildAc for patterns 'p'.
+	Counts comparisons (transitions tried and characters of verified patterns) and shifts
+	(characters read) into 'st' unless it is nil.
+*/
+func searchAc(t string, p []string, ac map[int]map[uint8]int, f map[int][]int, s []int, st *matching.Stats) (occurences map[int][]int) {
+	occurences = make(map[int][]int)
 	current := 0
 	for pos := 0; pos < len(t); pos++ {
-		if debugMode==true {
-			fmt.Printf("Position: %d, we read: %c", pos, t[pos])
-        }
+		if st != nil {
+			st.Shifts++
+			st.Shifted++
+			st.Comparisons++
+		}
+		if trace != nil {
+			trace.WindowMoved(pos, 1)
+		}
 		for getTransition(current, t[pos], ac) == -1 && s[current] != -1 {
+			if trace != nil {
+				trace.Compared(pos, t[pos], current, -1)
+			}
 			current = s[current]
+			if st != nil {
+				st.Comparisons++
+			}
+		}
+		if trace != nil {
+			trace.Compared(pos, t[pos], current, getTransition(current, t[pos], ac))
 		}
 		if getTransition(current, t[pos], ac) != -1 {
 			current = getTransition(current, t[pos], ac)
-			fmt.Printf(" (Continue) \n")
 		} else {
 			current = 0
-			if debugMode==true {
-				fmt.Printf(" (FAIL) \n")
-			}
 		}
 		_, ok := f[current]
 		if ok {
 			for i := range f[current] {
+				if st != nil {
+					st.Comparisons += len(p[f[current][i]])
+				}
 				if p[f[current][i]] == getWord(pos-len(p[f[current][i]])+1, pos, t) { //check for word match
-					if debugMode==true {
-						fmt.Printf("Occurence at position %d, %q = %q\n", pos-len(p[f[current][i]])+1, p[f[current][i]], p[f[current][i]])
+					occurences[f[current][i]] = append(occurences[f[current][i]], pos-len(p[f[current][i]])+1) //intArrayCapUp would copy all of them every time
+					if trace != nil {
+						trace.MatchFound(f[current][i], pos-len(p[f[current][i]])+1)
 					}
-					newOccurences := intArrayCapUp(occurences[f[current][i]])
-					occurences[f[current][i]] = newOccurences
-					occurences[f[current][i]][len(newOccurences)-1] = pos-len(p[f[current][i]])+1
 				}
 			}
 		}
 	}
-	elapsed := time.Since(startTime)
-	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
-	for key, value := range occurences { //prints all occurences of each pattern (if there was at least one)
-		fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
-		for i := range value {
-			fmt.Printf("%d", value[i])
-			if i != len(value) - 1 {
-				fmt.Printf(", ")
-			}
-		}
-		fmt.Printf(".")
-	}
-	return
+	return occurences
 }
 
 /**
@@ -114,11 +288,9 @@ func buildAc(p []string) (acToReturn map[int]map[uint8]int, f map[int][]int, s [
 	i := 0 //root of acTrie
 	acToReturn = acTrie
 	s[i] = -1
-	if debugMode==true {
-		fmt.Printf("\n\nAC construction: \n")
-	}
-	for current := 1; current < len(stateIsTerminal); current++ {
-		o, parent := getParent(current, acTrie)
+	order, parents, letters := breadthFirst(acTrie)
+	for _, current := range order { //shallower states first, their supply function is needed
+		o, parent := letters[current], parents[current]
 		down := s[parent]
 		for stateExists(down, acToReturn) && getTransition(down, o, acToReturn) == -1 {
 			down = s[down]
@@ -128,30 +300,11 @@ func buildAc(p []string) (acToReturn map[int]map[uint8]int, f map[int][]int, s [
 			if stateIsTerminal[s[current]] == true {
 				stateIsTerminal[current] = true
 				f[current] = arrayUnion(f[current], f[s[current]]) //F(Current) <- F(Current) union F(S(Current))
-				if debugMode==true {
-					fmt.Printf(" f[%d] set to: ", current)
-					for i := range f[current] {
-						fmt.Printf("%d\n", f[current][i])
-					}
-				}
 			}
 		} else {
 			s[current] = i //initial state?
 		}
 	}
-	if debugMode==true {
-		fmt.Printf("\nsupply function: \n")
-		for i:= range s {
-			fmt.Printf("\ns[%d]=%d", i, s[i])
-		}
-		fmt.Printf("\n\n")
-		for i,j := range f {
-			fmt.Printf("f[%d]=", i)
-			for k := range j {
-				fmt.Printf("%d\n", j[k])
-			}
-		}
-	}
 	return acToReturn, f, s
 }
 
@@ -167,11 +320,11 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
 	stateIsTerminal = make([]bool, 1)
 	f = make(map[int][]int) 
 	state := 1
-	if debugMode==true {
-		fmt.Printf("\n\nTrie construction: \n")
-	}
 	createNewState(0, trie)
 	for i:=0; i<len(p); i++ {
+		if len(p[i]) == 0 { //empty pattern has no occurences
+			continue
+		}
 		current := 0
 		j := 0
 		for j < len(p[i]) && getTransition(current, p[i][j], trie) != -1 {
@@ -191,15 +344,9 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
 			newArray := intArrayCapUp(f[current])
 			newArray[len(newArray)-1] = i
 			f[current] = newArray //F(Current) <- F(Current) union {i}
-			if debugMode==true {
-				fmt.Printf(" and %d", i)
-			}
 		} else {
 			stateIsTerminal[current] = true
 			f[current] = []int {i}  //F(Current) <- {i}
-			if debugMode==true {
-				fmt.Printf("\n%d is terminal for word number %d", current, i) 
-			}
 		}
 	}
 	return trie, stateIsTerminal, f
@@ -222,16 +369,13 @@ func contains(s []int, e int) bool {
 /*******************          String functions          *******************/
 /**
 	Function that returns word found in text 't' at position range 'begin' to 'end'.
+	Returns "" if the range is not inside the text. The word shares memory with 't'.
 */
 func getWord(begin, end int, t string) string {
-	for end >= len(t) {
+	if begin < 0 || end >= len(t) || begin > end {
 		return ""
 	}
-	d := make([]uint8, end-begin+1)
-	for j, i := 0, begin; i <= end; i, j = i+1, j+1 {
-		d[j] = t[i]
-	}
-	return string(d)
+	return t[begin:end+1]
 }
 
 /*******************   Array size allocation functions  *******************/
@@ -271,19 +415,27 @@ func arrayUnion (to, from []int) (concat []int) {
 
 /*******************          Automaton functions          *******************/
 /**
-	Function that finds the first previous state of a state and returns it. 
+	Function that returns all states of a trie except its root in breadth-first order,
+	with parent of each state and letter of the transition from the parent.
 	Used for trie where there is only one parent.
 	@param 'at' automaton
 */
-func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
-	for beginState, transitions := range at {
-		for c, endState := range transitions {
-			if endState == state {
-				return c, beginState
+func breadthFirst(at map[int]map[uint8]int) (order []int, parents []int, letters []uint8) {
+	parents, letters = make([]int, len(at)), make([]uint8, len(at))
+	queue := []int{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c := 0; c < 256; c++ { //letters in order, so that the debug output is always the same
+			endState := getTransition(state, uint8(c), at)
+			if endState != -1 {
+				parents[endState], letters[endState] = state, uint8(c)
+				order = append(order, endState)
+				queue = append(queue, endState)
 			}
 		}
 	}
-	return 0, 0 //unreachable
+	return order, parents, letters
 }
 
 /**
@@ -292,8 +444,8 @@ func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
 */
 func createNewState(state int, at map[int]map[uint8]int) {
 	at[state] = make(map[uint8]int)
-	if debugMode==true {
-		fmt.Printf("\ncreated state %d", state)
+	if trace != nil {
+		trace.StateCreated(state)
 	}
 }
 
@@ -303,8 +455,8 @@ func createNewState(state int, at map[int]map[uint8]int) {
 */
 func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
 	at[fromState][overChar]= toState
-	if debugMode==true {
-		fmt.Printf("\n    σ(%d,%c)=%d;",fromState,overChar,toState)
+	if trace != nil {
+		trace.TransitionAdded(fromState, overChar, toState)
 	}
 }
 
@@ -333,4 +485,537 @@ func stateExists(state int, at map[int]map[uint8]int)bool {
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
+/**
+	Counts transitions of automaton 'at'.
+	@param 'at' automaton
+*/
+func countTransitions(at map[int]map[uint8]int) (transitions int) {
+	for _, t := range at {
+		transitions += len(t)
+	}
+	return transitions
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+	Runs ahoCorasick, with the automaton loaded from automatonFile if it is set (loading is measured as building),
+	searching in chunks on several goroutines according to workers.
+	A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runAhoCorasick(in *matching.Input, p []string, st *matching.Stats) map[int][]int {
+	n := matching.Workers(workers, trace != nil)
+	if (in.Whole() && automatonFile == "" && n == 1) {
+		return ahoCorasick(in.Text, p, st)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	c, err := loadOrCompile(automatonFile, p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(c.ac), countTransitions(c.ac)
+	start = time.Now()
+	occurences, err := in.Search(c.Overlap(), n, st, c.Search)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Patterns with the automaton built by buildAc, ready to be saved and searched with.
+*/
+type compiled struct {
+	patterns []string
+	ac map[int]map[uint8]int
+	f map[int][]int
+	s []int
+}
+
+func compile(p []string) *compiled {
+	ac, f, s := buildAc(p)
+	return &compiled{p, ac, f, s}
+}
+
+/**
+	Compiles 'p' as matching.Matcher, for the file search and pattern sets.
+*/
+func compileMatcher(p []string) matching.Matcher {
+	return compile(p)
+}
+
+/**
+	Patterns the matcher was compiled for.
+*/
+func (c *compiled) Patterns() []string {
+	return c.patterns
+}
+
+/**
+	Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) Search(text string, st *matching.Stats) map[int][]int {
+	return searchAc(text, c.patterns, c.ac, c.f, c.s, st)
+}
+
+/**
+	Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) Overlap() int {
+	if (len(c.patterns) == 0) {
+		return 0
+	}
+	return longestPattern(c.patterns) - 1
+}
+
+/**
+	Length of the longest pattern in 'p'.
+*/
+func longestPattern(p []string) (lmax int) {
+	for i := range p {
+		if (len(p[i]) > lmax) {
+			lmax = len(p[i])
+		}
+	}
+	return lmax
+}
+
+const algorithmAc = 4
+
+/**
+	Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+	e := &matching.Encoder{}
+	e.Patterns(c.patterns)
+	e.Automaton(c.ac)
+	e.Outputs(c.f)
+	for _, v := range c.s {
+		e.Int(v)
+	}
+	return e.Save(w, algorithmAc)
+}
+
+/**
+	Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+	d, err := matching.Load(r, algorithmAc)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{patterns: d.Patterns()}
+	c.ac = d.Automaton()
+	c.f = d.Outputs(len(c.ac), c.patterns, 1)
+	if d.Err == nil && len(c.ac) == 0 {
+		d.Fail("automaton without states")
+	}
+	c.s = make([]int, len(c.ac))
+	for i := range c.s {
+		if c.s[i] = d.Int(); c.s[i] < -1 || c.s[i] >= len(c.s) || (c.s[i] == -1) != (i == 0) {
+			d.Fail("supply function s[%d]=%d", i, c.s[i])
+			break
+		}
+	}
+	if d.Err == nil {
+		depth := depths(c.ac)
+		for i := 1; i < len(c.s); i++ {
+			if depth[i] < 0 || depth[c.s[i]] >= depth[i] { //searching would follow the links forever
+				d.Fail("supply function s[%d]=%d does not lead to a shallower state", i, c.s[i])
+			}
+		}
+	}
+	if err := d.End(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+	Loads matcher for patterns 'p' from file 'path', or compiles it and saves it there
+	if the file does not exist or holds a matcher of other patterns.
+	Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path string, p []string) (*compiled, error) {
+	return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(p) },
+		func(c *compiled) bool { return matching.SamePatterns(c.patterns, p) })
+}
+
+/**
+	Returns length of the shortest path from the root to each state of automaton 'at', -1 if there is none.
+*/
+func depths(at map[int]map[uint8]int) []int {
+	depth := make([]int, len(at))
+	for i := range depth {
+		depth[i] = -1
+	}
+	depth[0] = 0
+	for queue := []int{0}; len(queue) > 0; queue = queue[1:] {
+		for _, to := range at[queue[0]] {
+			if depth[to] == -1 {
+				depth[to] = depth[queue[0]] + 1
+				queue = append(queue, to)
+			}
+		}
+	}
+	return depth
+}
+
+/*******************          Replace functions          *******************/
+
+/**
+	How replacing resolves overlapping occurences.
+*/
+type overlapRule int
+
+const (
+	leftmostLongest overlapRule = iota //the leftmost occurence, of the longest pattern where more of them start, as matching.LeftmostLongest
+	leftmostFirst //the leftmost occurence, of the pattern given first where more of them start, as matching.LeftmostFirst
+	highestPriority //occurences of the pattern given first, then those of the next pattern which do not overlap them and so on, wherever they start
+)
+
+/**
+	Names of the rules given by -overlap.
+*/
+var overlapRules = map[string]overlapRule{"longest": leftmostLongest, "first": leftmostFirst, "priority": highestPriority}
+
+func (rule overlapRule) String() string {
+	for name, r := range overlapRules {
+		if (r == rule) {
+			return name
+		}
+	}
+	return fmt.Sprintf("overlapRule(%d)", int(rule))
+}
+
+/**
+	Size of blocks in which replace reads the text.
+*/
+const replaceBlock = 1 << 16
+
+/**
+	Rewrites texts, replacing occurences of patterns found by Aho-Corasick automaton.
+*/
+type replacer struct {
+	c *compiled
+	replacement func(pattern int, match string) string
+	rule overlapRule
+	lmax int
+}
+
+/**
+	Returns replacer of 'patterns' (none of them empty) by whatever 'replacement' returns for the
+	number of the pattern and the occurence, overlapping occurences resolved by 'rule'.
+*/
+func newReplacer(patterns []string, replacement func(pattern int, match string) string, rule overlapRule) *replacer {
+	return &replacer{compile(patterns), replacement, rule, longestPattern(patterns)}
+}
+
+/**
+	Returns replacer of every pattern by the replacement at the same index.
+*/
+func pairsReplacer(patterns, replacements []string, rule overlapRule) *replacer {
+	return newReplacer(patterns, func(pattern int, match string) string {
+		return replacements[pattern]
+	}, rule)
+}
+
+/**
+	Returns replacement masking every character of an occurence by 'mask'.
+*/
+func maskReplacement(mask string) func(pattern int, match string) string {
+	return func(pattern int, match string) string {
+		return strings.Repeat(mask, len(match))
+	}
+}
+
+/**
+	Returns 'text' with the occurences replaced.
+*/
+func (r *replacer) replaceString(text string) string {
+	var rewritten strings.Builder
+	r.replace(&rewritten, strings.NewReader(text))
+	return rewritten.String()
+}
+
+/**
+	Streams the text read from 'in' to 'out' with the occurences replaced. The automaton reads the text once.
+	By the leftmost rules an occurence is replaced as soon as the occurences starting at its position are known
+	(the longest pattern later), so only the last block read and the longest pattern are kept, however the occurences chain.
+	By priority overlapping occurences are collected into a cluster, which is resolved once no later occurence can overlap it.
+*/
+func (r *replacer) replace(out io.Writer, in io.Reader) error {
+	if (r.rule == highestPriority) {
+		return r.replaceClusters(out, in)
+	}
+	w := bufio.NewWriter(out)
+	block := make([]byte, replaceBlock)
+	var kept []byte //text from position 'base' on
+	best := make([]int, r.lmax) //pattern chosen among occurences starting at position i, at index i % lmax, -1 for none
+	for i := range best {
+		best[i] = -1
+	}
+	base, written, decided, current := 0, 0, 0, 0 //occurences starting before 'decided' are replaced or dropped
+	decide := func(until int) { //decides occurences starting before 'until'
+		for ; decided < until; decided++ {
+			k := best[decided % r.lmax]
+			best[decided % r.lmax] = -1
+			if (k >= 0 && decided >= written) { //not inside an occurence replaced before
+				end := decided + len(r.c.patterns[k])
+				w.Write(kept[written - base:decided - base])
+				w.WriteString(r.replacement(k, string(kept[decided - base:end - base])))
+				written = end
+			}
+		}
+	}
+	for {
+		n, err := in.Read(block)
+		for _, b := range block[:n] {
+			kept = append(kept, b)
+			pos := base + len(kept) - 1
+			current = r.step(current, b)
+			for _, k := range r.c.f[current] {
+				start := pos - len(r.c.patterns[k]) + 1
+				if (start < written || string(kept[start - base:pos - base + 1]) != r.c.patterns[k]) { //inside a replaced occurence, check for word match
+					continue
+				}
+				chosen := &best[start % r.lmax]
+				if (*chosen == -1 || (r.rule == leftmostLongest && len(r.c.patterns[k]) > len(r.c.patterns[*chosen])) ||
+					(len(r.c.patterns[k]) == len(r.c.patterns[*chosen]) || r.rule == leftmostFirst) && k < *chosen) {
+					*chosen = k
+				}
+			}
+			decide(pos - r.lmax + 2) //no later occurence starts before it
+		}
+		if (err == io.EOF) {
+			decide(base + len(kept))
+			w.Write(kept[written - base:])
+			return w.Flush()
+		}
+		if (decided > written) { //text no occurence can replace any more
+			w.Write(kept[written - base:decided - base])
+			written = decided
+		}
+		kept, base = append(kept[:0], kept[written - base:]...), written
+		if (err != nil) {
+			w.Flush()
+			return err
+		}
+	}
+}
+
+/**
+	Streams the text as replace does by priority: overlapping occurences are collected into a cluster which is
+	resolved once no later occurence can overlap it (the longest pattern ahead). Only the part of the text
+	that may still be replaced is kept, the rest is written as soon as it is read.
+*/
+func (r *replacer) replaceClusters(out io.Writer, in io.Reader) error {
+	w := bufio.NewWriter(out)
+	block := make([]byte, replaceBlock)
+	var kept []byte //text from position 'base' on
+	var cluster []matching.Occurence
+	base, written, current := 0, 0, 0
+	clusterStart, clusterEnd := 0, 0
+	replaceCluster := func() {
+		for _, o := range r.resolve(cluster) {
+			end := o.Pos + len(r.c.patterns[o.Pattern])
+			w.Write(kept[written - base:o.Pos - base])
+			w.WriteString(r.replacement(o.Pattern, string(kept[o.Pos - base:end - base])))
+			written = end
+		}
+		cluster = cluster[:0]
+	}
+	for {
+		n, err := in.Read(block)
+		for _, b := range block[:n] {
+			kept = append(kept, b)
+			pos := base + len(kept) - 1
+			current = r.step(current, b)
+			for _, k := range r.c.f[current] {
+				start := pos - len(r.c.patterns[k]) + 1
+				if (string(kept[start - base:pos - base + 1]) != r.c.patterns[k]) { //check for word match
+					continue
+				}
+				if (len(cluster) == 0 || start < clusterStart) {
+					clusterStart = start
+				}
+				cluster, clusterEnd = append(cluster, matching.Occurence{Pos: start, Pattern: k}), pos + 1
+			}
+			if (len(cluster) > 0 && pos - r.lmax + 2 >= clusterEnd) { //no later occurence can overlap the cluster
+				replaceCluster()
+			}
+		}
+		safe := base + len(kept) - r.lmax + 1 //start of the first occurence that may end in the next block
+		if (len(cluster) > 0 && clusterStart < safe) {
+			safe = clusterStart
+		}
+		if (safe > written) {
+			w.Write(kept[written - base:safe - base])
+			written = safe
+		}
+		kept, base = append(kept[:0], kept[written - base:]...), written
+		if (err == io.EOF) {
+			replaceCluster()
+			w.Write(kept[written - base:])
+			return w.Flush()
+		}
+		if (err != nil) {
+			w.Flush()
+			return err
+		}
+	}
+}
+
+/**
+	Next state of the automaton after reading 'b' in state 'current', as searchAc moves.
+*/
+func (r *replacer) step(current int, b uint8) int {
+	for getTransition(current, b, r.c.ac) == -1 && r.c.s[current] != -1 {
+		current = r.c.s[current]
+	}
+	if next := getTransition(current, b, r.c.ac); (next != -1) {
+		return next
+	}
+	return 0
+}
+
+/**
+	Returns occurences of a cluster to be replaced by priority, which do not overlap, ordered by position.
+*/
+func (r *replacer) resolve(cluster []matching.Occurence) (chosen []matching.Occurence) {
+	candidates := append([]matching.Occurence(nil), cluster...)
+	length := func(o matching.Occurence) int { return len(r.c.patterns[o.Pattern]) }
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.Pattern != b.Pattern) {
+			return a.Pattern < b.Pattern
+		}
+		return a.Pos < b.Pos
+	})
+	for _, o := range candidates {
+		overlaps := false
+		for _, c := range chosen {
+			if (o.Pos < c.Pos + length(c) && c.Pos < o.Pos + length(o)) {
+				overlaps = true
+				break
+			}
+		}
+		if (!overlaps) {
+			chosen = append(chosen, o)
+		}
+	}
+	sort.Slice(chosen, func(i, j int) bool { return chosen[i].Pos < chosen[j].Pos })
+	return chosen
+}
+
+/**
+	Rewrites files (standard input when none or "-") to standard output or -o file, with command line arguments
+	[-pairs file | -patterns file [-mask string]] [-overlap longest|first|priority] [-o file] [file]...
+	Pairs file has a pattern, a tab and its replacement on every line; patterns file has patterns
+	separated by single spaces, each character of their occurences is replaced by the mask.
+	Priority of a pattern is given by its order in the file, the first one is the most important.
+	@return exit status, 0 on success, 2 after an error
+*/
+func replaceFiles(args []string, in io.Reader, out, errors io.Writer) int {
+	flags := flag.NewFlagSet("replace", flag.ContinueOnError)
+	flags.SetOutput(errors)
+	pairsFile := flags.String("pairs", "", "file with a pattern, a tab and its replacement on every line")
+	patternFile := flags.String("patterns", "patterns.txt", "file with the patterns to be masked separated by single spaces")
+	mask := flags.String("mask", "*", "replaces every character of the masked occurences")
+	overlap := flags.String("overlap", "longest", "resolves overlapping occurences: longest (leftmost-longest), first (leftmost-first) or priority")
+	output := flags.String("o", "", "file to write to instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	rule, ok := overlapRules[*overlap]
+	if (!ok) {
+		fmt.Fprintf(errors, "-overlap %q: longest, first or priority expected\n", *overlap)
+		return 2
+	}
+	r, err := readReplacer(*pairsFile, *patternFile, *mask, rule)
+	if (err != nil) {
+		fmt.Fprintln(errors, err)
+		return 2
+	}
+	if (*output != "") {
+		file, err := os.Create(*output)
+		if (err != nil) {
+			fmt.Fprintln(errors, err)
+			return 2
+		}
+		defer file.Close()
+		out = file
+	}
+	paths := flags.Args()
+	if (len(paths) == 0) {
+		paths = []string{"-"}
+	}
+	for _, path := range paths {
+		if (path == "-") {
+			err = r.replace(out, in)
+		} else {
+			var file *os.File
+			if file, err = os.Open(path); (err == nil) {
+				err = r.replace(out, file)
+				file.Close()
+			}
+		}
+		if (err != nil) {
+			fmt.Fprintln(errors, err)
+			return 2
+		}
+	}
+	return 0
+}
+
+/**
+	Returns replacer of the pairs in file 'pairsFile' or, if it is empty, masking the patterns in 'patternFile'.
+*/
+func readReplacer(pairsFile, patternFile, mask string, rule overlapRule) (*replacer, error) {
+	var patterns, replacements []string
+	if (pairsFile != "") {
+		data, err := ioutil.ReadFile(pairsFile)
+		if (err != nil) {
+			return nil, err
+		}
+		for i, pair := range strings.Split(string(data), "\n") {
+			pair = strings.TrimSuffix(pair, "\r")
+			if (pair == "") {
+				continue
+			}
+			tab := strings.IndexByte(pair, '\t')
+			if (tab <= 0) {
+				return nil, fmt.Errorf("%s:%d: pattern, tab and replacement expected", pairsFile, i + 1)
+			}
+			patterns, replacements = append(patterns, pair[:tab]), append(replacements, pair[tab + 1:])
+		}
+		if (len(patterns) == 0) {
+			return nil, fmt.Errorf("%s: no pairs", pairsFile)
+		}
+		return pairsReplacer(patterns, replacements, rule), nil
+	}
+	data, err := ioutil.ReadFile(patternFile)
+	if (err != nil) {
+		return nil, err
+	}
+	for _, pattern := range strings.Split(strings.TrimRight(string(data), "\r\n"), " ") {
+		if (len(pattern) > 0) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if (len(patterns) == 0) {
+		return nil, fmt.Errorf("%s: no patterns", patternFile)
+	}
+	return newReplacer(patterns, maskReplacement(mask), rule), nil
+}
+
+/*******************          Pattern set functions          *******************/
+
+/**
+	Returns set of the non-empty 'patterns' searched by Aho-Corasick, see matching.PatternSet.
+*/
+func newPatternSet(patterns []string) (*matching.PatternSet, error) {
+	return matching.NewPatternSet(patterns, compileMatcher, semantics, matching.Workers(workers, false))
+}
@@ -0,0 +1,338 @@
+package main
+import ("testing"; "strings"; "math/rand"; "io/ioutil"; "path/filepath"; "bytes"; "testing/iotest"; "io"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	Aho-Corasick as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "ahoCorasick",
+	Set: true,
+	Search: ahoCorasick,
+	Trace: &trace,
+	States: true,
+	Algorithm: algorithmAc,
+	Compile: compile,
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: loadOrCompile,
+	Compiled: func(c *compiled) matching.Search { return c.Search },
+	Overlap: (*compiled).Overlap,
+	Patterns: (*compiled).Patterns,
+	EmptyPatterns: true,
+	Verifies: true,
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	The example and the sets used in test-results.txt.
+*/
+func TestTestdata(t *testing.T) {
+	matchingtest.CheckTestdata(t, algorithm, ".")
+}
+
+/**
+	Run with: go test -fuzz FuzzAc ac.go ac_test.go
+	Patterns are separated by single spaces as in patterns.txt, so some of them may be empty.
+	Inputs that failed are saved in testdata/fuzz/FuzzAc and checked by every go test.
+*/
+func FuzzAc(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	defer func() { trace = nil }()
+	p := []string{"he", "she", "his", "hers"}
+	ac, f, s := buildAc(p)
+	g, path := matching.NewGraph("ac", ac), matching.NewSearchPath()
+	for state := 1; state < len(s); state++ {
+		g.Links[state] = s[state]
+	}
+	g.AddOutputSets(f)
+	trace = path
+	searchAc("ushers", p, ac, f, s, nil)
+	trace = nil
+	g.Highlight(path)
+	matchingtest.CheckGraph(t, g, "5 -> 2 [style=dashed, color=red, penwidth=2, constraint=false];")
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled ac.go ac_test.go
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzBuildAc ac.go ac_test.go
+	Each pattern leads from the root to a state, which is terminal for it,
+	and supply function of each state leads to a shallower one.
+*/
+func FuzzBuildAc(f *testing.F) {
+	for _, c := range matchingtest.SetCases {
+		f.Add(strings.Join(c.Patterns, " "))
+	}
+	f.Fuzz(func(t *testing.T, patterns string) {
+		p := strings.Split(patterns, " ")
+		ac, terminal, s := buildAc(p)
+		checkTrie(t, p, ac, terminal)
+		order, parents, _ := breadthFirst(ac)
+		depth := make([]int, len(ac))
+		for _, state := range order {
+			depth[state] = depth[parents[state]] + 1
+			if s[state] < 0 || depth[s[state]] >= depth[state] {
+				t.Errorf("%q: supply function of state %d (depth %d) is %d", p, state, depth[state], s[state])
+			}
+		}
+	})
+}
+
+/**
+	Checks that each non-empty pattern of 'p' leads from the root of 'at' to a state terminal for it.
+*/
+func checkTrie(t *testing.T, p []string, at map[int]map[uint8]int, terminal map[int][]int) {
+	for i := range p {
+		if len(p[i]) == 0 {
+			continue
+		}
+		state := 0
+		for j := 0; j < len(p[i]) && state != -1; j++ {
+			state = getTransition(state, p[i][j], at)
+		}
+		if state == -1 || !contains(terminal[state], i) {
+			t.Errorf("%q: pattern %q does not lead to its terminal state", p, p[i])
+		}
+	}
+}
+
+/**
+	Run with: go test -run XXX -bench . ac.go ac_test.go
+	Building the automaton and searching for all patterns of each corpus are measured separately.
+*/
+func BenchmarkAc(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, ".", func(text string, p []string) func() {
+		ac, f, s := buildAc(p)
+		return func() { searchAc(text, p, ac, f, s, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
+
+/**
+	Replaces the way the rules are described: leftmost-first (leftmost-longest) takes the first (longest) pattern
+	found at the leftmost position and goes on after it, priority replaces occurences of the first pattern,
+	then those of the next one not overlapping any replaced before, and so on.
+*/
+func naiveReplace(text string, patterns, replacements []string, rule overlapRule) string {
+	var rewritten strings.Builder
+	if rule == leftmostFirst || rule == leftmostLongest {
+		for i := 0; i < len(text); {
+			longest := -1
+			for k, pattern := range patterns {
+				if strings.HasPrefix(text[i:], pattern) && (longest == -1 || (rule == leftmostLongest && len(pattern) > len(patterns[longest]))) {
+					longest = k
+				}
+			}
+			if longest == -1 {
+				rewritten.WriteByte(text[i])
+				i++
+				continue
+			}
+			rewritten.WriteString(replacements[longest])
+			i += len(patterns[longest])
+		}
+		return rewritten.String()
+	}
+	covered := make([]bool, len(text))
+	replaced := make(map[int]int) //position -> pattern
+	for k, pattern := range patterns {
+		for _, pos := range matchingtest.BruteForce(text, []string{pattern})[0] {
+			free := true
+			for i := pos; i < pos + len(pattern); i++ {
+				free = free && !covered[i]
+			}
+			if free {
+				for i := pos; i < pos + len(pattern); i++ {
+					covered[i] = true
+				}
+				replaced[pos] = k
+			}
+		}
+	}
+	for i := 0; i < len(text); {
+		if k, ok := replaced[i]; ok {
+			rewritten.WriteString(replacements[k])
+			i += len(patterns[k])
+			continue
+		}
+		rewritten.WriteByte(text[i])
+		i++
+	}
+	return rewritten.String()
+}
+
+/**
+	Overlapping occurences are resolved by each rule, masking keeps the length,
+	and the text streamed a byte at a time is rewritten as the whole one is.
+*/
+func TestReplace(t *testing.T) {
+	patterns, replacements := []string{"he", "she", "hers", "his"}, []string{"1", "2", "3", "4"}
+	if rewritten := pairsReplacer(patterns, replacements, leftmostLongest).replaceString("ushers his"); rewritten != "u2rs 4" {
+		t.Errorf("leftmost-longest: %q", rewritten)
+	}
+	if rewritten := pairsReplacer(patterns, replacements, highestPriority).replaceString("ushers his"); rewritten != "us1rs 4" {
+		t.Errorf("priority: %q", rewritten)
+	}
+	identifiers := []string{"1234-5678", "ab12"}
+	if masked := newReplacer(identifiers, maskReplacement("#"), highestPriority).replaceString("ab1234-5678!"); masked != "ab#########!" {
+		t.Errorf("masked by priority: %q", masked)
+	}
+	if masked := newReplacer(identifiers, maskReplacement("#"), leftmostLongest).replaceString("ab1234-5678!"); masked != "####34-5678!" {
+		t.Errorf("masked leftmost-longest: %q", masked)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		text := matchingtest.RandomString(r, "abc", r.Intn(100))
+		patterns, replacements = nil, nil
+		for j := 1 + r.Intn(5); j > 0; j-- {
+			patterns = append(patterns, matchingtest.RandomString(r, "abc", 1 + r.Intn(4)))
+			replacements = append(replacements, matchingtest.RandomString(r, "XY", r.Intn(3)))
+		}
+		for _, rule := range []overlapRule{leftmostFirst, leftmostLongest, highestPriority} {
+			expected := naiveReplace(text, patterns, replacements, rule)
+			replacer := pairsReplacer(patterns, replacements, rule)
+			if rewritten := replacer.replaceString(text); rewritten != expected {
+				t.Fatalf("%q in %q by rule %v: %q, expected %q", patterns, text, rule, rewritten, expected)
+			}
+			var streamed bytes.Buffer
+			if err := replacer.replace(&streamed, iotest.OneByteReader(strings.NewReader(text))); err != nil || streamed.String() != expected {
+				t.Fatalf("%q in %q by rule %v streamed: %q, expected %q (%v)", patterns, text, rule, streamed.String(), expected, err)
+			}
+		}
+	}
+}
+
+/**
+	Reader of 'n' times letter 'a', counting what was read.
+*/
+type runReader struct {
+	n, read int
+}
+
+func (r *runReader) Read(p []byte) (int, error) {
+	if r.read == r.n {
+		return 0, io.EOF
+	}
+	if len(p) > r.n - r.read {
+		p = p[:r.n - r.read]
+	}
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += len(p)
+	return len(p), nil
+}
+
+/**
+	Writer checking that the output never lags behind the input by more than 'limit' bytes.
+*/
+type lagWriter struct {
+	in *runReader
+	written, lag int
+}
+
+func (w *lagWriter) Write(p []byte) (int, error) {
+	if lag := w.in.read - w.written; lag > w.lag {
+		w.lag = lag
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+/**
+	By the leftmost rules occurences chaining over a long run (every "aa" overlaps the next one) are written
+	as they are found, so the text kept does not grow with the run.
+*/
+func TestReplaceChainStreamed(t *testing.T) {
+	for _, rule := range []overlapRule{leftmostFirst, leftmostLongest} {
+		in := &runReader{n: 16 * replaceBlock}
+		out := &lagWriter{in: in}
+		if err := newReplacer([]string{"aa", "aaa"}, maskReplacement("#"), rule).replace(out, in); err != nil {
+			t.Fatal(err)
+		}
+		if out.written != in.n {
+			t.Errorf("%v: %d bytes written of %d", rule, out.written, in.n)
+		}
+		if out.lag > 2 * replaceBlock { //the block read, the longest pattern and the buffer of the writer
+			t.Errorf("%v: output lagged %d bytes behind the input", rule, out.lag)
+		}
+	}
+}
+
+/**
+	Command line replacing reads pairs or masks patterns, and refuses wrong arguments.
+*/
+func TestReplaceFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"pairs.txt": "she\tSHE\nhers\t\n", "bad.txt": "he\n", "patterns.txt": "he his\n",
+		"text.txt": "ushers his\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replace := func(stdin string, args ...string) (int, string) {
+		var out, errors bytes.Buffer
+		status := replaceFiles(args, strings.NewReader(stdin), &out, &errors)
+		return status, out.String()
+	}
+	if status, out := replace("", "-pairs", filepath.Join(dir, "pairs.txt"), filepath.Join(dir, "text.txt")); status != 0 || out != "uSHErs his\n" {
+		t.Errorf("pairs: status %d, %q", status, out)
+	}
+	if status, out := replace("she sells", "-patterns", filepath.Join(dir, "patterns.txt"), "-overlap", "priority", "-"); status != 0 || out != "s** sells" {
+		t.Errorf("mask: status %d, %q", status, out)
+	}
+	output := filepath.Join(dir, "out.txt")
+	if status, _ := replace("", "-patterns", filepath.Join(dir, "patterns.txt"), "-mask", "", "-o", output, filepath.Join(dir, "text.txt")); status != 0 {
+		t.Errorf("output: status %d", status)
+	}
+	if data, _ := ioutil.ReadFile(output); string(data) != "usrs \n" {
+		t.Errorf("output: %q", data)
+	}
+	for _, args := range [][]string{{"-overlap", "shortest"}, {"-pairs", filepath.Join(dir, "bad.txt")}, {"-patterns", filepath.Join(dir, "missing.txt")},
+		{"-patterns", filepath.Join(dir, "patterns.txt"), filepath.Join(dir, "missing.txt")}} {
+		if status, _ := replace("", args...); status != 2 {
+			t.Errorf("%v: status %d", args, status)
+		}
+	}
+}
+
+func TestPatternSet(t *testing.T) {
+	matchingtest.CheckPatternSet(t, newPatternSet)
+}
@@ -1,13 +1,81 @@
 package main
-import ("fmt"; "log"; "strings"; "io/ioutil"; "time")
+import ("fmt"; "log"; "os"; "strings"; "io"; "io/ioutil"; "time"; "stringmatching/matching")
 
 /** 
 	User defined.
 	
-	@true prints various extra stuff out, but slows down the execution
-	@false will be quick and quiet
+	@"text" prints various extra stuff out (to stderr), but slows down the execution
+	@"json" prints the same events as JSON, one per line (to stderr)
+	@"" will be quick and quiet
 */
-const debugMode bool = true
+const traceMode string = "text"
+
+/**
+	Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+	User defined.
+
+	@"dot" writes the automaton to automaton.dot (Graphviz)
+	@"mermaid" writes it to automaton.mmd (Mermaid flowchart)
+	@"" exports nothing
+*/
+const exportFormat string = ""
+
+/**
+	User defined.
+
+	@true highlights transitions taken while searching in the text in the export
+	@false exports the automaton only
+*/
+const exportSearchPath bool = true
+
+/**
+	User defined.
+
+	@"" builds the automaton on every run
+	@"file name" loads the compiled automaton from the file, or builds it and saves it there
+	if the file does not exist yet or was built for other patterns
+*/
+const automatonFile string = ""
+
+/**
+	User defined.
+
+	@"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+	@"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+	User defined.
+
+	@1 searches the text sequentially
+	@n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+	@0 uses a goroutine for every CPU core
+	The search is sequential while tracing.
+*/
+const workers int = 1
+
+/**
+	User defined.
+
+	@false searches inputFile
+	@true searches files, globs and directories given on the command line recursively (see matching.SearchFiles),
+	printing file:line:col:pattern for every occurence
+*/
+const fileSearch bool = false
+
+/**
+	User defined.
+
+	@matching.AllOccurences reports every occurence of every pattern, overlapping ones too
+	@matching.LeftmostFirst reports occurences that do not overlap, of the pattern given first where more of them start
+	@matching.LeftmostLongest reports occurences that do not overlap, of the longest pattern where more of them start
+*/
+const semantics matching.Semantics = matching.AllOccurences
 
 /**
  	Implementation of Advanced Aho-Corasick algorithm (Prefix based).
@@ -16,51 +84,153 @@ const debugMode bool = true
 	
 	@file 'patterns.txt' containing the patterns to be searched for separated by single spaces
 	@file 'text.txt' containing the text to be searched in
+	If(fileSearch == true) searches files given on the command line instead, see searchFiles.
 */
 func main() {
+	if (fileSearch == true) {
+		os.Exit(matching.SearchFiles(os.Args[1:], os.Stdout, os.Stderr, compileMatcher, semantics, matching.Workers(workers, false)))
+	}
 	patFile, err := ioutil.ReadFile("patterns.txt")
 	if err != nil {
 		log.Fatal(err)
 	}
-	textFile, err := ioutil.ReadFile("text.txt")
+	in, err := matching.OpenInput(inputFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer in.Close()
+	if (traceMode != "" || exportFormat != "") { //both show the text, so a streamed one is read whole
+		if err := in.ReadAll(); err != nil {
+			log.Fatal(err)
+		}
+	}
 	patterns := strings.Split(string(patFile), " ")
 	fmt.Printf("\nRunning: Advanced Aho-Corasick algorithm.\n\n")
-	if debugMode==true { 
+	setTracer(in.Text)
+	if trace != nil { 
 		fmt.Printf("Searching for %d patterns/words:\n",len(patterns))
 	}
 	for i := 0; i < len(patterns); i++ {
-		if (len(patterns[i]) > len(textFile)) {
+		if (in.Whole() && len(patterns[i]) > len(in.Text)) {
 			log.Fatal("There is a pattern that is longer than text! Pattern number:", i+1)
 		}
-		if debugMode==true { 
+		if trace != nil { 
 			fmt.Printf("%q ", patterns[i])
 		}
 	}
-	if debugMode==true { 
-		fmt.Printf("\n\nIn text (%d chars long): \n%q\n\n",len(textFile), textFile)
+	if trace != nil { 
+		fmt.Printf("\n\nIn text (%s): \n%s\n\n", in.Length(), in.Preview())
+	}
+	printResult(in, patterns)
+	export(in.Text, patterns)
+}
+
+/**
+	Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+	var err error
+	if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Exports the whole goto function of extended Aho-Corasick automaton of patterns 'p'
+	with output sets according to exportFormat, with transitions taken while searching in 't'
+	if exportSearchPath is set.
+*/
+func export(t string, p []string) {
+	if exportFormat == "" {
+		return
+	}
+	previous := trace
+	trace = nil //construction was already traced by the search
+	ac, f := buildExtendedAc(p)
+	g := matching.NewGraph("Extended Aho-Corasick automaton", ac)
+	g.AddOutputSets(f)
+	if exportSearchPath == true {
+		path := matching.NewSearchPath()
+		trace = path
+		searchExtendedAc(t, p, ac, f, nil)
+		g.Highlight(path)
+	}
+	trace = previous
+	if err := matching.ExportGraph(g, exportFormat); err != nil {
+		log.Fatal(err)
+	}
+}
+
+/**
+	Runs ahoCorasick and prints how long it took and occurences of each pattern
+	(if there was at least one) in the order of patterns, and statistics of the search.
+*/
+func printResult(in *matching.Input, p []string) {
+	startTime := time.Now()
+	st := &matching.Stats{}
+	occurences := matching.SelectMatches(runAhoCorasick(in, p, st), p, semantics)
+	elapsed := time.Since(startTime)
+	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
+	for key := range p {
+		value, ok := occurences[key]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
+		for i := range value {
+			fmt.Printf("%d", value[i])
+			if i != len(value) - 1 {
+				fmt.Printf(", ")
+			}
+		}
+		fmt.Printf(".")
 	}
-	ahoCorasick(string(textFile), patterns)
+	fmt.Printf("\n\n%s", st)
 }
 
 /**
 	Function performing the Basic Aho-Corasick alghoritm. 
-	Finds and prints occurences of each pattern. 
+	Finds occurences of each pattern, empty patterns are not searched for. 
 	
 	@param t text to be searched in
 	@param p list of patterns to be serached for
+	@param st statistics to be filled, nil if not wanted
+	@return occurences map with keys of pattern indexes and values - positions in text, in increasing order
 */  
-func ahoCorasick(t string, p []string) {
-	startTime := time.Now()
-	occurences := make(map[int][]int)
-	ac, f := buildExtendedAc(p)
-	if debugMode==true {
-		fmt.Printf("\n\nAC:\n\n")
+func ahoCorasick(t string, p []string, st *matching.Stats) (occurences map[int][]int) {
+	if st == nil {
+		ac, f := buildExtendedAc(p)
+		return searchExtendedAc(t, p, ac, f, nil)
 	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	ac, f := buildExtendedAc(p)
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(ac), countTransitions(ac)
+	start = time.Now()
+	occurences = searchExtendedAc(t, p, ac, f, st)
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Searching part of ahoCorasick, automaton 'ac' with terminal states 'f'
+	is built by buildExtendedAc for patterns 'p'.
+	Counts comparisons (transitions tried and characters of verified patterns) and shifts
+	(characters read) into 'st' unless it is nil.
+*/
+func searchExtendedAc(t string, p []string, ac map[int]map[uint8]int, f map[int][]int, st *matching.Stats) (occurences map[int][]int) {
+	occurences = make(map[int][]int)
 	current := 0
 	for pos := 0; pos < len(t); pos++ {
+		if st != nil {
+			st.Shifts++
+			st.Shifted++
+			st.Comparisons++
+		}
+		if trace != nil {
+			trace.WindowMoved(pos, 1)
+			trace.Compared(pos, t[pos], current, getTransition(current, t[pos], ac))
+		}
 		if getTransition(current, t[pos], ac) != -1 {
 			current = getTransition(current, t[pos], ac)
 		} else {
@@ -69,30 +239,19 @@ func ahoCorasick(t string, p []string) {
 		_, ok := f[current]
 		if ok {
 			for i := range f[current] {
+				if st != nil {
+					st.Comparisons += len(p[f[current][i]])
+				}
 				if p[f[current][i]] == getWord(pos-len(p[f[current][i]])+1, pos, t) { //check for word match
-					if debugMode==true {
-						fmt.Printf("Occurence at position %d, %q = %q\n", pos-len(p[f[current][i]])+1, p[f[current][i]], p[f[current][i]])
+					occurences[f[current][i]] = append(occurences[f[current][i]], pos-len(p[f[current][i]])+1) //intArrayCapUp would copy all of them every time
+					if trace != nil {
+						trace.MatchFound(f[current][i], pos-len(p[f[current][i]])+1)
 					}
-					newOccurences := intArrayCapUp(occurences[f[current][i]])
-					occurences[f[current][i]] = newOccurences
-					occurences[f[current][i]][len(newOccurences)-1] = pos-len(p[f[current][i]])+1
 				}
 			}
 		}
 	}
-	elapsed := time.Since(startTime)
-	fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
-	for key, value := range occurences { //prints all occurences of each pattern (if there was at least one)
-		fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
-		for i := range value {
-			fmt.Printf("%d", value[i])
-			if i != len(value) - 1 {
-				fmt.Printf(", ")
-			}
-		}
-		fmt.Printf(".")
-	}
-	return
+	return occurences
 }
 
 /**
@@ -104,11 +263,9 @@ func buildExtendedAc(p []string) (acToReturn map[int]map[uint8]int, f map[int][]
 	i := 0 //root of acTrie
 	acToReturn = acTrie
 	s[i] = -1
-	if debugMode==true {
-		fmt.Printf("\n\nAC construction: \n")
-	}
-	for current := 1; current < len(stateIsTerminal); current++ {
-		o, parent := getParent(current, acTrie)
+	order, parents, letters := breadthFirst(acTrie)
+	for _, current := range order { //shallower states first, their supply function is needed
+		o, parent := letters[current], parents[current]
 		down := s[parent]
 		for stateExists(down, acToReturn) && getTransition(down, o, acToReturn) == -1 {
 			down = s[down]
@@ -118,42 +275,20 @@ func buildExtendedAc(p []string) (acToReturn map[int]map[uint8]int, f map[int][]
 			if stateIsTerminal[s[current]] == true {
 				stateIsTerminal[current] = true
 				f[current] = arrayUnion(f[current], f[s[current]]) //F(Current) <- F(Current) union F(S(Current))
-				if debugMode==true {
-					fmt.Printf(" f[%d] set to: ", current)
-					for i := range f[current] {
-						fmt.Printf("%d\n", f[current][i])
-					}
-				}
 			}
 		} else {
 			s[current] = i //initial state?
 		}
 	}
-	if debugMode==true {
-		fmt.Printf("\nsupply function: \n")
-		for i:= range s {
-			fmt.Printf("\ns[%d]=%d", i, s[i])
-		}
-		fmt.Printf("\n\n")
-		for i,j := range f {
-			fmt.Printf("f[%d]=", i)
-			for k := range j {
-				fmt.Printf("%d\n", j[k])
-			}
-		}
-	}
-	if debugMode==true {
-		fmt.Printf("\n\nAdAC completion: \n")
-	}
 	//advanced Aho-Corasick part
 	a := computeAlphabet(p) //concat of all patterns in p
-	for j := range a {
+	for j := 0; j < len(a); j++ {
 		if getTransition(i, a[j], acToReturn) == -1 {
 			createTransition(i, a[j], i, acToReturn)
 		}
 	}
-	for current := 1; current < len(stateIsTerminal); current++ {
-		for j := range a {
+	for _, current := range order { //transitions of the supply state have to be complete
+		for j := 0; j < len(a); j++ { //bytes, range would skip inside of UTF-8 characters
 			if getTransition(current, a[j], acToReturn) == -1 {
 				createTransition(current, a[j], getTransition(s[current], a[j], acToReturn), acToReturn)
 			}
@@ -174,11 +309,11 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
 	stateIsTerminal = make([]bool, 1)
 	f = make(map[int][]int) 
 	state := 1
-	if debugMode==true {
-		fmt.Printf("\n\nTrie construction: \n")
-	}
 	createNewState(0, trie)
 	for i:=0; i<len(p); i++ {
+		if len(p[i]) == 0 { //empty pattern has no occurences
+			continue
+		}
 		current := 0
 		j := 0
 		for j < len(p[i]) && getTransition(current, p[i][j], trie) != -1 {
@@ -198,15 +333,9 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
 			newArray := intArrayCapUp(f[current])
 			newArray[len(newArray)-1] = i
 			f[current] = newArray //F(Current) <- F(Current) union {i}
-			if debugMode==true {
-				fmt.Printf(" and %d", i)
-			}
 		} else {
 			stateIsTerminal[current] = true
 			f[current] = []int {i}  //F(Current) <- {i}
-			if debugMode==true {
-				fmt.Printf("\n%d is terminal for word number %d", current, i) 
-			}
 		}
 	}
 	return trie, stateIsTerminal, f
@@ -229,24 +358,20 @@ func contains(s []int, e int) bool {
 /*******************          String functions          *******************/
 /**
 	Function that returns word found in text 't' at position range 'begin' to 'end'.
+	Returns "" if the range is not inside the text. The word shares memory with 't'.
 */
 func getWord(begin, end int, t string) string {
-	for end >= len(t) {
+	if begin < 0 || end >= len(t) || begin > end {
 		return ""
 	}
-	d := make([]uint8, end-begin+1)
-	for j, i := 0, begin; i <= end; i, j = i+1, j+1 {
-		d[j] = t[i]
-	}
-	return string(d)
+	return t[begin:end+1]
 }
 
 /**
 	Function that returns string of all the possible characters in given patterns.
 */
 func computeAlphabet(p []string)(s string) {
-	s = p[0]
-	for i := 1; i < len(p); i++ {
+	for i := 0; i < len(p); i++ {
 		s = s + p[i]
 	}
 	return s
@@ -289,19 +414,27 @@ func arrayUnion (to, from []int) (concat []int) {
 
 /*******************          Automaton functions          *******************/
 /**
-	Function that finds the first previous state of a state and returns it. 
+	Function that returns all states of a trie except its root in breadth-first order,
+	with parent of each state and letter of the transition from the parent.
 	Used for trie where there is only one parent.
 	@param 'at' automaton
 */
-func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
-	for beginState, transitions := range at {
-		for c, endState := range transitions {
-			if endState == state {
-				return c, beginState
+func breadthFirst(at map[int]map[uint8]int) (order []int, parents []int, letters []uint8) {
+	parents, letters = make([]int, len(at)), make([]uint8, len(at))
+	queue := []int{0}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c := 0; c < 256; c++ { //letters in order, so that the debug output is always the same
+			endState := getTransition(state, uint8(c), at)
+			if endState != -1 {
+				parents[endState], letters[endState] = state, uint8(c)
+				order = append(order, endState)
+				queue = append(queue, endState)
 			}
 		}
 	}
-	return 0, 0 //unreachable
+	return order, parents, letters
 }
 
 /**
@@ -310,8 +443,8 @@ func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
 */
 func createNewState(state int, at map[int]map[uint8]int) {
 	at[state] = make(map[uint8]int)
-	if debugMode==true {
-		fmt.Printf("\ncreated state %d", state)
+	if trace != nil {
+		trace.StateCreated(state)
 	}
 }
 
@@ -321,8 +454,8 @@ func createNewState(state int, at map[int]map[uint8]int) {
 */
 func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
 	at[fromState][overChar]= toState
-	if debugMode==true {
-		fmt.Printf("\n    σ(%d,%c)=%d;",fromState,overChar,toState)
+	if trace != nil {
+		trace.TransitionAdded(fromState, overChar, toState)
 	}
 }
 
@@ -351,4 +484,147 @@ func stateExists(state int, at map[int]map[uint8]int)bool {
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
+/**
+	Counts transitions of automaton 'at'.
+	@param 'at' automaton
+*/
+func countTransitions(at map[int]map[uint8]int) (transitions int) {
+	for _, t := range at {
+		transitions += len(t)
+	}
+	return transitions
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+	Runs ahoCorasick, with the automaton loaded from automatonFile if it is set (loading is measured as building),
+	searching in chunks on several goroutines according to workers.
+	A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runAhoCorasick(in *matching.Input, p []string, st *matching.Stats) map[int][]int {
+	n := matching.Workers(workers, trace != nil)
+	if (in.Whole() && automatonFile == "" && n == 1) {
+		return ahoCorasick(in.Text, p, st)
+	}
+	start, memory := time.Now(), matching.AllocatedBytes()
+	c, err := loadOrCompile(automatonFile, p)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+	st.States, st.Transitions = len(c.ac), countTransitions(c.ac)
+	start = time.Now()
+	occurences, err := in.Search(c.Overlap(), n, st, c.Search)
+	if err != nil {
+		log.Fatal(err)
+	}
+	st.Search = time.Since(start)
+	return occurences
+}
+
+/**
+	Patterns with the automaton built by buildExtendedAc, ready to be saved and searched with.
+*/
+type compiled struct {
+	patterns []string
+	ac map[int]map[uint8]int
+	f map[int][]int
+}
+
+func compile(p []string) *compiled {
+	ac, f := buildExtendedAc(p)
+	return &compiled{p, ac, f}
+}
+
+/**
+	Compiles 'p' as matching.Matcher, for the file search and pattern sets.
+*/
+func compileMatcher(p []string) matching.Matcher {
+	return compile(p)
+}
+
+/**
+	Patterns the matcher was compiled for.
+*/
+func (c *compiled) Patterns() []string {
+	return c.patterns
+}
+
+/**
+	Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) Search(text string, st *matching.Stats) map[int][]int {
+	return searchExtendedAc(text, c.patterns, c.ac, c.f, st)
+}
+
+/**
+	Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) Overlap() int {
+	if (len(c.patterns) == 0) {
+		return 0
+	}
+	return longestPattern(c.patterns) - 1
+}
+
+/**
+	Length of the longest pattern in 'p'.
+*/
+func longestPattern(p []string) (lmax int) {
+	for i := range p {
+		if (len(p[i]) > lmax) {
+			lmax = len(p[i])
+		}
+	}
+	return lmax
+}
+
+const algorithmAdac = 5
+
+/**
+	Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+	e := &matching.Encoder{}
+	e.Patterns(c.patterns)
+	e.Automaton(c.ac)
+	e.Outputs(c.f)
+	return e.Save(w, algorithmAdac)
+}
+
+/**
+	Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+	d, err := matching.Load(r, algorithmAdac)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{patterns: d.Patterns()}
+	c.ac = d.Automaton()
+	c.f = d.Outputs(len(c.ac), c.patterns, 1)
+	if err := d.End(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+/**
+	Loads matcher for patterns 'p' from file 'path', or compiles it and saves it there
+	if the file does not exist or holds a matcher of other patterns.
+	Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path string, p []string) (*compiled, error) {
+	return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(p) },
+		func(c *compiled) bool { return matching.SamePatterns(c.patterns, p) })
+}
+
+/*******************          Pattern set functions          *******************/
+
+/**
+	Returns set of the non-empty 'patterns' searched by Aho-Corasick, see matching.PatternSet.
+*/
+func newPatternSet(patterns []string) (*matching.PatternSet, error) {
+	return matching.NewPatternSet(patterns, compileMatcher, semantics, matching.Workers(workers, false))
+}
@@ -0,0 +1,147 @@
+package main
+import ("testing"; "strings"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	Aho-Corasick with the full automaton as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "ahoCorasick",
+	Set: true,
+	Search: ahoCorasick,
+	Trace: &trace,
+	States: true,
+	Algorithm: algorithmAdac,
+	Compile: compile,
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: loadOrCompile,
+	Compiled: func(c *compiled) matching.Search { return c.Search },
+	Overlap: (*compiled).Overlap,
+	Patterns: (*compiled).Patterns,
+	EmptyPatterns: true,
+	Verifies: true,
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	The example and the sets used in test-results.txt.
+*/
+func TestTestdata(t *testing.T) {
+	matchingtest.CheckTestdata(t, algorithm, ".")
+}
+
+/**
+	Run with: go test -fuzz FuzzAdac adac.go adac_test.go
+	Patterns are separated by single spaces as in patterns.txt, so some of them may be empty.
+	Inputs that failed are saved in testdata/fuzz/FuzzAdac and checked by every go test.
+*/
+func FuzzAdac(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	defer func() { trace = nil }()
+	p := []string{"he", "she", "his", "hers"}
+	ac, f := buildExtendedAc(p)
+	g, path := matching.NewGraph("ac", ac), matching.NewSearchPath()
+	g.AddOutputSets(f)
+	trace = path
+	searchExtendedAc("ushers", p, ac, f, nil)
+	trace = nil
+	g.Highlight(path)
+	matchingtest.CheckGraph(t, g, "5 -> 8 [label=\"r\", color=red, penwidth=2];")
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled adac.go adac_test.go
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzBuildExtendedAc adac.go adac_test.go
+	Each pattern leads from the root to a state, which is terminal for it,
+	and every state has a transition for every letter of the patterns.
+*/
+func FuzzBuildExtendedAc(f *testing.F) {
+	for _, c := range matchingtest.SetCases {
+		f.Add(strings.Join(c.Patterns, " "))
+	}
+	f.Fuzz(func(t *testing.T, patterns string) {
+		p := strings.Split(patterns, " ")
+		ac, terminal := buildExtendedAc(p)
+		checkTrie(t, p, ac, terminal)
+		a := computeAlphabet(p)
+		for state := range ac {
+			for j := 0; j < len(a); j++ {
+				if getTransition(state, a[j], ac) == -1 {
+					t.Errorf("%q: no transition from state %d over %q", p, state, a[j])
+				}
+			}
+		}
+	})
+}
+
+/**
+	Checks that each non-empty pattern of 'p' leads from the root of 'at' to a state terminal for it.
+*/
+func checkTrie(t *testing.T, p []string, at map[int]map[uint8]int, terminal map[int][]int) {
+	for i := range p {
+		if len(p[i]) == 0 {
+			continue
+		}
+		state := 0
+		for j := 0; j < len(p[i]) && state != -1; j++ {
+			state = getTransition(state, p[i][j], at)
+		}
+		if state == -1 || !contains(terminal[state], i) {
+			t.Errorf("%q: pattern %q does not lead to its terminal state", p, p[i])
+		}
+	}
+}
+
+/**
+	Run with: go test -run XXX -bench . adac.go adac_test.go
+	Building the automaton and searching for all patterns of each corpus are measured separately.
+*/
+func BenchmarkAdac(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, ".", func(text string, p []string) func() {
+		ac, f := buildExtendedAc(p)
+		return func() { searchExtendedAc(text, p, ac, f, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
+
+func TestPatternSet(t *testing.T) {
+	matchingtest.CheckPatternSet(t, newPatternSet)
+}
@@ -1,13 +1,81 @@
 ﻿package main
-import ("fmt"; "log"; "strings"; "io/ioutil"; "time")
+import ("fmt"; "log"; "os"; "strings"; "io"; "io/ioutil"; "time"; "stringmatching/matching")
 
 /** 
         User defined.
         
-        @true prints various extra stuff out, but slows down the execution
-        @false will be quick and quiet
+        @"text" prints various extra stuff out (to stderr), but slows down the execution
+        @"json" prints the same events as JSON, one per line (to stderr)
+        @"" will be quick and quiet
 */
-const debugMode bool = true
+const traceMode string = "text"
+
+/**
+        Receives events of the algorithm, nil for no tracing. Set by main according to traceMode.
+*/
+var trace matching.Tracer
+
+/**
+        User defined.
+
+        @"dot" writes the oracle to automaton.dot (Graphviz)
+        @"mermaid" writes it to automaton.mmd (Mermaid flowchart)
+        @"" exports nothing
+*/
+const exportFormat string = ""
+
+/**
+        User defined.
+
+        @true highlights transitions taken while searching in the text in the export
+        @false exports the oracle only
+*/
+const exportSearchPath bool = true
+
+/**
+        User defined.
+
+        @"" builds the oracle on every run
+        @"file name" loads the compiled oracle from the file, or builds it and saves it there
+        if the file does not exist yet or was built for other patterns
+*/
+const automatonFile string = ""
+
+/**
+        User defined.
+
+        @"file name" the file to be searched in ("text.txt"), mapped into memory on Linux (see matching.OpenInput)
+        @"-" reads the text from standard input
+*/
+const inputFile string = "text.txt"
+
+/**
+        User defined.
+
+        @1 searches the text sequentially
+        @n splits the text into overlapping chunks searched by n goroutines sharing one compiled automaton
+        @0 uses a goroutine for every CPU core
+        The search is sequential while tracing.
+*/
+const workers int = 1
+
+/**
+        User defined.
+
+        @false searches inputFile
+        @true searches files, globs and directories given on the command line recursively (see matching.SearchFiles),
+        printing file:line:col:pattern for every occurence
+*/
+const fileSearch bool = false
+
+/**
+        User defined.
+
+        @matching.AllOccurences reports every occurence of every pattern, overlapping ones too
+        @matching.LeftmostFirst reports occurences that do not overlap, of the pattern given first where more of them start
+        @matching.LeftmostLongest reports occurences that do not overlap, of the longest pattern where more of them start
+*/
+const semantics matching.Semantics = matching.AllOccurences
 
 /**
          Implementation of Set Backward Oracle Matching algorithm (Factor based).
@@ -16,103 +84,185 @@ const debugMode bool = true
         
         @file 'patterns.txt' containing the patterns to be searched for separated by single spaces
         @file 'text.txt' containing the text to be searched in
+        If(fileSearch == true) searches files given on the command line instead, see searchFiles.
 */
 func main() {
+        if (fileSearch == true) {
+                os.Exit(matching.SearchFiles(os.Args[1:], os.Stdout, os.Stderr, compileMatcher, semantics, matching.Workers(workers, false)))
+        }
         patFile, err := ioutil.ReadFile("patterns.txt")
         if err != nil {
                 log.Fatal(err)
         }
-        textFile, err := ioutil.ReadFile("text.txt")
+        in, err := matching.OpenInput(inputFile)
         if err != nil {
                 log.Fatal(err)
         }
+        defer in.Close()
+        if (traceMode != "" || exportFormat != "") { //both show the text, so a streamed one is read whole
+                if err := in.ReadAll(); err != nil {
+                        log.Fatal(err)
+                }
+        }
         patterns := strings.Split(string(patFile), " ")
         fmt.Printf("\nRunning: Set Backward Oracle Matching algorithm.\n\n")
-        if debugMode==true { 
+        setTracer(in.Text)
+        if trace != nil { 
                 fmt.Printf("Searching for %d patterns/words:\n",len(patterns))
         }
         for i := 0; i < len(patterns); i++ {
-                if (len(patterns[i]) > len(textFile)) {
+                if (in.Whole() && len(patterns[i]) > len(in.Text)) {
                         log.Fatal("There is a pattern that is longer than text! Pattern number:", i+1)
                 }
-                if debugMode==true { 
+                if trace != nil { 
                         fmt.Printf("%q ", patterns[i])
                 }
         }
-        if debugMode==true { 
-                fmt.Printf("\n\nIn text (%d chars long): \n%q\n\n",len(textFile), textFile)
+        if trace != nil { 
+                fmt.Printf("\n\nIn text (%s): \n%s\n\n", in.Length(), in.Preview())
         }
-        sbom(string(textFile), patterns)
+        printResult(in, patterns)
+        export(in.Text, patterns)
+}
+
+/**
+        Sets 'trace' according to traceMode for searching in 'text'.
+*/
+func setTracer(text string) {
+        var err error
+        if trace, err = matching.NewTracer(traceMode, os.Stderr, text); err != nil {
+                log.Fatal(err)
+        }
+}
+
+/**
+        Exports factor oracle of patterns 'p' (trimmed to the shortest one and reversed) with output sets
+        according to exportFormat, with transitions taken while searching in 't' if exportSearchPath is set.
+*/
+func export(t string, p []string) {
+        lmin := computeMinLength(p)
+        if exportFormat == "" || lmin == 0 {
+                return
+        }
+        previous := trace
+        trace = nil //construction was already traced by the search
+        or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+        g := matching.NewGraph("Factor oracle of reversed patterns", or)
+        g.AddOutputSets(f)
+        if exportSearchPath == true {
+                path := matching.NewSearchPath()
+                trace = path
+                searchSbom(t, p, lmin, or, f, nil)
+                g.Highlight(path)
+        }
+        trace = previous
+        if err := matching.ExportGraph(g, exportFormat); err != nil {
+                log.Fatal(err)
+        }
+}
+
+/**
+        Runs sbom and prints how long it took and occurences of each pattern
+        (if there was at least one) in the order of patterns, and statistics of the search.
+*/
+func printResult(in *matching.Input, p []string) {
+        startTime := time.Now()
+        st := &matching.Stats{}
+        occurences := matching.SelectMatches(runSbom(in, p, st), p, semantics)
+        elapsed := time.Since(startTime)
+        fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
+        for key := range p {
+                value, ok := occurences[key]
+                if !ok {
+                        continue
+                }
+                fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
+                for i := range value {
+                        fmt.Printf("%d", value[i])
+                        if i != len(value) - 1 {
+                                fmt.Printf(", ")
+                        }
+                }
+                fmt.Printf(".")
+        }
+        fmt.Printf("\n\n%s", st)
 }
 
 /**
         Function sbom performing the Set Backward Oracle Matching alghoritm. 
-        Finds and prints occurences of each pattern. 
+        Finds occurences of each pattern, empty patterns are not searched for. 
         
         @param t text to be searched in
         @param p list of patterns to be serached for
+        @param st statistics to be filled, nil if not wanted
+        @return occurences map with keys of pattern indexes and values - positions in text, in increasing order
 */  
-func sbom(t string, p []string) {
-        startTime := time.Now()
-        occurences := make(map[int][]int)
+func sbom(t string, p []string, st *matching.Stats) (occurences map[int][]int) {
         lmin := computeMinLength(p)
-        or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
-        if debugMode==true {
-                fmt.Printf("\n\nSBOM:\n\n")
+        if lmin == 0 { //no pattern to search for
+                return make(map[int][]int)
         }
+        if st == nil {
+                or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+                return searchSbom(t, p, lmin, or, f, nil)
+        }
+        start, memory := time.Now(), matching.AllocatedBytes()
+        or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+        st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+        st.States, st.Transitions = len(or), countTransitions(or)
+        start = time.Now()
+        occurences = searchSbom(t, p, lmin, or, f, st)
+        st.Search = time.Since(start)
+        return occurences
+}
+
+/**
+        Searching part of sbom, oracle 'or' with terminal states 'f' is built by buildOracleMultiple
+        for patterns 'p' trimmed to the length of the shortest one 'lmin' (at least 1) and reversed.
+        Counts comparisons (characters read in the oracle and of verified patterns) and shifts
+        into 'st' unless it is nil.
+*/
+func searchSbom(t string, p []string, lmin int, or map[int]map[uint8]int, f map[int][]int, st *matching.Stats) (occurences map[int][]int) {
+        occurences = make(map[int][]int)
         pos := 0
         for pos <= len(t) - lmin {
                 current := 0
                 j := lmin
-                if debugMode==true {
-                        fmt.Printf("Position: %d, we read: ", pos)
-                }
                 for j >= 1 && stateExists(current, or) {
-                        if debugMode==true {
-                                fmt.Printf("%c", t[pos+j-1])
+                        if trace != nil {
+                                trace.Compared(pos+j-1, t[pos+j-1], current, getTransition(current, t[pos+j-1], or))
                         }
                         current = getTransition(current, t[pos+j-1], or)
-                        if debugMode==true {
-                                if (current == -1) {
-                                        fmt.Printf(" (FAIL) ")
-                                } else {
-                                        fmt.Printf(", ")
-                                }
+                        if st != nil {
+                                st.Comparisons++
                         }
                         j--
                 }
-                if debugMode==true {
-                        fmt.Printf("in the factor oracle. \n")
-                }
                 word := getWord(pos, pos+lmin-1, t)
-                if stateExists(current, or) && j == 0 && strings.HasPrefix(word, getCommonPrefix(p, f[current], lmin)) { //check for prefix match
+                if stateExists(current, or) && j == 0 && len(f[current]) > 0 && strings.HasPrefix(word, getCommonPrefix(p, f[current], lmin)) { //check for prefix match
                         for i := range f[current] {
+                                if st != nil {
+                                        st.Comparisons += len(p[f[current][i]])
+                                }
                                 if p[f[current][i]] == getWord(pos, pos-1+len(p[f[current][i]]), t) { //check for word match
-                                        if debugMode==true {
-                                                fmt.Printf("- Occurence, %q = %q\n", p[f[current][i]], word)
+                                        occurences[f[current][i]] = append(occurences[f[current][i]], pos) //intArrayCapUp would copy all of them every time
+                                        if trace != nil {
+                                                trace.MatchFound(f[current][i], pos)
                                         }
-                                        newOccurences := intArrayCapUp(occurences[f[current][i]])
-                                        occurences[f[current][i]] = newOccurences
-                                        occurences[f[current][i]][len(newOccurences)-1] = pos
                                 }
                         }
                         j = 0
                 }
                 pos = pos + j + 1
-        }
-        elapsed := time.Since(startTime)
-        fmt.Printf("\n\nElapsed %f secs\n", elapsed.Seconds())
-        for key, value := range occurences { //prints all occurences of each pattern (if there was at least one)
-                fmt.Printf("\nThere were %d occurences for word: %q at positions: ",len(value), p[key])
-                for i := range value {
-                        fmt.Printf("%d", value[i])
-                        if i != len(value) - 1 {
-                                fmt.Printf(", ")
-                        }
+                if st != nil {
+                        st.Shifts++
+                        st.Shifted += j + 1
+                }
+                if trace != nil {
+                        trace.WindowMoved(pos, j + 1)
                 }
-                fmt.Printf(".")
         }
-        return
+        return occurences
 }
 
 /**
@@ -124,11 +274,9 @@ func buildOracleMultiple (p []string) (orToReturn map[int]map[uint8]int, f map[i
         i := 0 //root of trie
         orToReturn = orTrie
         s[i] = -1
-        if debugMode==true {
-                fmt.Printf("\n\nOracle construction: \n")
-        }
-        for current := 1; current < len(stateIsTerminal); current++ {
-                o, parent := getParent(current, orTrie)
+        order, parents, letters := breadthFirst(orTrie)
+        for _, current := range order { //shallower states first, their supply function is needed
+                o, parent := letters[current], parents[current]
                 down := s[parent]
                 for stateExists(down, orToReturn) && getTransition(down, o, orToReturn) == -1 {
                         createTransition(down, o, current, orToReturn)
@@ -155,11 +303,11 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
         stateIsTerminal = make([]bool, 1)
         f = make(map[int][]int) 
         state := 1
-        if debugMode==true {
-                fmt.Printf("\n\nTrie construction: \n")
-        }
         createNewState(0, trie)
         for i:=0; i<len(p); i++ {
+                if len(p[i]) == 0 { //empty pattern has no occurences
+                        continue
+                }
                 current := 0
                 j := 0
                 for j < len(p[i]) && getTransition(current, p[i][j], trie) != -1 {
@@ -179,15 +327,9 @@ func constructTrie (p []string) (trie map[int]map[uint8]int, stateIsTerminal []b
                         newArray := intArrayCapUp(f[current])
                         newArray[len(newArray)-1] = i
                         f[current] = newArray //F(Current) <- F(Current) union {i}
-                        if debugMode==true {
-                                fmt.Printf(" and %d", i)
-                        }
                 } else {
                         stateIsTerminal[current] = true
                         f[current] = []int {i}  //F(Current) <- {i}
-                        if debugMode==true {
-                                fmt.Printf("\n%d is terminal for word number %d", current, i) 
-                        }
                 }
         }
         return trie, stateIsTerminal, f
@@ -227,15 +369,15 @@ func reverseAll(s []string) (reversed []string) {
 }
 
 /**        
-        Function that takes a single string and reverses it.
-        @author 'Walter' http://stackoverflow.com/a/10043083
+        Function that takes a single string and reverses it byte by byte
+        (the oracle works on bytes, so this holds for any text, not only UTF-8).
 */
 func reverse(s string) string {
     l := len(s)
-    m := make([]rune, l)
-    for _, c := range s {
+    m := make([]uint8, l)
+    for i := 0; i < len(s); i++ {
         l--
-        m[l] = c
+        m[l] = s[i]
     }
     return string(m)
 }
@@ -246,52 +388,44 @@ func reverse(s string) string {
         thanks to the konwledge of 'lmin'.
 */
 func getCommonPrefix(p []string, f []int, lmin int) string {
-        r := []rune(p[f[0]])
-        newR := make([]rune, lmin)
-        for j := 0; j < lmin; j++ {
-                newR[j] = r[j]
-        }
-        return string(newR)
+        return p[f[0]][:lmin]
 }
 
 /**
         Function that takes a set of strings 'p' and their wanted 'length'
         and then trims each string in that set to have desired 'length'.
+        Shorter (empty) strings are left as they are.
 */
 func trimToLength(p []string, length int) (trimmedP []string) {
         trimmedP = make([]string, len(p))
         for i := range p {
-                r := []rune(p[i])
-                newR := make([]rune, length)
-                for j := 0; j < length; j++ {
-                        newR[j] = r[j]
+                if len(p[i]) < length {
+                        trimmedP[i] = p[i]
+                        continue
                 }
-                trimmedP[i]=string(newR)
+                trimmedP[i] = p[i][:length]
         }
         return trimmedP
 }
 
 /**
         Function that returns word found in text 't' at position range 'begin' to 'end'.
+        Returns "" if the range is not inside the text. The word shares memory with 't'.
 */
 func getWord(begin, end int, t string) string {
-        for end >= len(t) {
+        if begin < 0 || end >= len(t) || begin > end {
                 return ""
         }
-        d := make([]uint8, end-begin+1)
-        for j, i := 0, begin; i <= end; i, j = i+1, j+1 {
-                d[j] = t[i]
-        }
-        return string(d)
+        return t[begin:end+1]
 }
 
 /**
         Function that computes minimal length string in a set of strings.
+        Empty strings are skipped, '0' is returned if there is no other.
 */
 func computeMinLength(p []string) (lmin int){
-        lmin = len(p[0])
-        for i:=1; i<len(p); i++ {
-                if (len(p[i])<lmin) {
+        for i:=0; i<len(p); i++ {
+                if (len(p[i]) > 0 && (lmin == 0 || len(p[i])<lmin)) {
                         lmin = len(p[i])
                 }
         }
@@ -300,19 +434,27 @@ func computeMinLength(p []string) (lmin int){
 
 /*******************          Automaton functions          *******************/
 /**
-        Function that finds the first previous state of a state and returns it. 
+        Function that returns all states of a trie except its root in breadth-first order,
+        with parent of each state and letter of the transition from the parent.
         Used for trie where there is only one parent.
         @param 'at' automaton
 */
-func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
-        for beginState, transitions := range at {
-                for c, endState := range transitions {
-                        if endState == state {
-                                return c, beginState
+func breadthFirst(at map[int]map[uint8]int) (order []int, parents []int, letters []uint8) {
+        parents, letters = make([]int, len(at)), make([]uint8, len(at))
+        queue := []int{0}
+        for len(queue) > 0 {
+                state := queue[0]
+                queue = queue[1:]
+                for c := 0; c < 256; c++ { //letters in order, so that the debug output is always the same
+                        endState := getTransition(state, uint8(c), at)
+                        if endState != -1 {
+                                parents[endState], letters[endState] = state, uint8(c)
+                                order = append(order, endState)
+                                queue = append(queue, endState)
                         }
                 }
         }
-        return 0, 0 //unreachable
+        return order, parents, letters
 }
 
 /**
@@ -321,8 +463,8 @@ func getParent(state int, at map[int]map[uint8]int) (uint8, int) {
 */
 func createNewState(state int, at map[int]map[uint8]int) {
         at[state] = make(map[uint8]int)
-        if debugMode==true {
-                fmt.Printf("\ncreated state %d", state)
+        if trace != nil {
+                trace.StateCreated(state)
         }
 }
 
@@ -332,8 +474,8 @@ func createNewState(state int, at map[int]map[uint8]int) {
 */
 func createTransition(fromState int, overChar uint8, toState int, at map[int]map[uint8]int) {
         at[fromState][overChar]= toState
-        if debugMode==true {
-                fmt.Printf("\n    σ(%d,%c)=%d;",fromState,overChar,toState)
+        if trace != nil {
+                trace.TransitionAdded(fromState, overChar, toState)
         }
 }
 
@@ -362,4 +504,156 @@ func stateExists(state int, at map[int]map[uint8]int)bool {
                 return false
         }
         return true
-}
\ No newline at end of file
+}
+/**
+        Counts transitions of automaton 'at'.
+        @param 'at' automaton
+*/
+func countTransitions(at map[int]map[uint8]int) (transitions int) {
+        for _, t := range at {
+                transitions += len(t)
+        }
+        return transitions
+}
+
+/*******************          Compiled matcher functions          *******************/
+/**
+        Runs sbom, with the oracle loaded from automatonFile if it is set (loading is measured as building),
+        searching in chunks on several goroutines according to workers.
+        A streamed text is searched chunk by chunk as it is read (see matching.Input).
+*/
+func runSbom(in *matching.Input, p []string, st *matching.Stats) map[int][]int {
+        n := matching.Workers(workers, trace != nil)
+        if (in.Whole() && automatonFile == "" && n == 1) || computeMinLength(p) == 0 {
+                return sbom(in.Text, p, st)
+        }
+        start, memory := time.Now(), matching.AllocatedBytes()
+        c, err := loadOrCompile(automatonFile, p)
+        if err != nil {
+                log.Fatal(err)
+        }
+        st.Build, st.Memory = time.Since(start), matching.AllocatedBytes() - memory
+        st.States, st.Transitions = len(c.or), countTransitions(c.or)
+        start = time.Now()
+        occurences, err := in.Search(c.Overlap(), n, st, c.Search)
+        if err != nil {
+                log.Fatal(err)
+        }
+        st.Search = time.Since(start)
+        return occurences
+}
+
+/**
+        Patterns with the oracle built by buildOracleMultiple for them trimmed to 'lmin' and reversed,
+        ready to be saved and searched with.
+*/
+type compiled struct {
+        patterns []string
+        lmin int
+        or map[int]map[uint8]int
+        f map[int][]int
+}
+
+/**
+        Compiles patterns 'p', at least one of them has to be non-empty.
+*/
+func compile(p []string) *compiled {
+        lmin := computeMinLength(p)
+        or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+        return &compiled{p, lmin, or, f}
+}
+
+/**
+        Compiles 'p' as matching.Matcher, for the file search and pattern sets.
+*/
+func compileMatcher(p []string) matching.Matcher {
+        return compile(p)
+}
+
+/**
+        Patterns the matcher was compiled for.
+*/
+func (c *compiled) Patterns() []string {
+        return c.patterns
+}
+
+/**
+        Searches 'text' with the compiled matcher, which is only read, so goroutines can share it.
+*/
+func (c *compiled) Search(text string, st *matching.Stats) map[int][]int {
+        return searchSbom(text, c.patterns, c.lmin, c.or, c.f, st)
+}
+
+/**
+        Characters by which chunks of a text searched in parallel must overlap.
+*/
+func (c *compiled) Overlap() int {
+        if (len(c.patterns) == 0) {
+                return 0
+        }
+        return longestPattern(c.patterns) - 1
+}
+
+/**
+        Length of the longest pattern in 'p'.
+*/
+func longestPattern(p []string) (lmax int) {
+        for i := range p {
+                if (len(p[i]) > lmax) {
+                        lmax = len(p[i])
+                }
+        }
+        return lmax
+}
+
+const algorithmSbom = 6
+
+/**
+        Writes compiled matcher 'c' to 'w'.
+*/
+func writeCompiled(w io.Writer, c *compiled) error {
+        e := &matching.Encoder{}
+        e.Patterns(c.patterns)
+        e.Automaton(c.or)
+        e.Outputs(c.f)
+        return e.Save(w, algorithmSbom)
+}
+
+/**
+        Reads compiled matcher written by writeCompiled, any damage is reported as an error.
+*/
+func readCompiled(r io.Reader) (*compiled, error) {
+        d, err := matching.Load(r, algorithmSbom)
+        if err != nil {
+                return nil, err
+        }
+        c := &compiled{patterns: d.Patterns()}
+        if c.lmin = computeMinLength(c.patterns); d.Err == nil && c.lmin == 0 {
+                d.Fail("no pattern to search for")
+        }
+        c.or = d.Automaton()
+        c.f = d.Outputs(len(c.or), c.patterns, c.lmin)
+        if err := d.End(); err != nil {
+                return nil, err
+        }
+        return c, nil
+}
+
+/**
+        Loads matcher for patterns 'p' from file 'path', or compiles it and saves it there
+        if the file does not exist or holds a matcher of other patterns.
+        Only compiles it when 'path' is empty.
+*/
+func loadOrCompile(path string, p []string) (*compiled, error) {
+        return matching.LoadOrCompile(path, readCompiled, writeCompiled, func() *compiled { return compile(p) },
+                func(c *compiled) bool { return matching.SamePatterns(c.patterns, p) })
+}
+
+/*******************          Pattern set functions          *******************/
+
+/**
+        Returns set of the non-empty 'patterns' searched by Set Backward Oracle Matching, see matching.PatternSet.
+*/
+func newPatternSet(patterns []string) (*matching.PatternSet, error) {
+        return matching.NewPatternSet(patterns, compileMatcher, semantics, matching.Workers(workers, false))
+}
@@ -0,0 +1,147 @@
+package main
+import ("testing"; "strings"; "stringmatching/matching"; "stringmatching/matching/matchingtest")
+
+/**
+	SBOM as the shared checks of package matchingtest see it.
+*/
+var algorithm = matchingtest.Algorithm[*compiled]{
+	Name: "sbom",
+	Set: true,
+	Search: sbom,
+	Trace: &trace,
+	States: true,
+	Algorithm: algorithmSbom,
+	Compile: compile,
+	Write: writeCompiled,
+	Read: readCompiled,
+	LoadOrCompile: loadOrCompile,
+	Compiled: func(c *compiled) matching.Search { return c.Search },
+	Overlap: (*compiled).Overlap,
+	Patterns: (*compiled).Patterns,
+	Verifies: true,
+}
+
+func TestCases(t *testing.T) {
+	matchingtest.CheckCases(t, algorithm)
+}
+
+func TestRandom(t *testing.T) {
+	matchingtest.CheckRandom(t, algorithm)
+}
+
+/**
+	The example and the sets used in test-results.txt.
+*/
+func TestTestdata(t *testing.T) {
+	matchingtest.CheckTestdata(t, algorithm, ".")
+}
+
+/**
+	Run with: go test -fuzz FuzzSbom sbom.go sbom_test.go
+	Patterns are separated by single spaces as in patterns.txt, so some of them may be empty.
+	Inputs that failed are saved in testdata/fuzz/FuzzSbom and checked by every go test.
+*/
+func FuzzSbom(f *testing.F) {
+	matchingtest.Fuzz(f, algorithm)
+}
+
+func TestTrace(t *testing.T) {
+	matchingtest.CheckTrace(t, algorithm)
+}
+
+func TestJSONTrace(t *testing.T) {
+	matchingtest.CheckJSONTrace(t, algorithm)
+}
+
+/**
+	Exported graph has all states and edges, final states and the highlighted path of a search.
+*/
+func TestExport(t *testing.T) {
+	defer func() { trace = nil }()
+	p := []string{"he", "she", "his", "hers"}
+	or, f := buildOracleMultiple(reverseAll(trimToLength(p, 2)))
+	g, path := matching.NewGraph("oracle", or), matching.NewSearchPath()
+	g.AddOutputSets(f)
+	trace = path
+	searchSbom("ushers", p, 2, or, f, nil)
+	trace = nil
+	g.Highlight(path)
+	matchingtest.CheckGraph(t, g, "2 [label=\"2\\n{0, 3}\", shape=doublecircle];")
+}
+
+func TestCompiled(t *testing.T) {
+	matchingtest.CheckCompiled(t, algorithm)
+}
+
+func TestLoadOrCompile(t *testing.T) {
+	matchingtest.CheckLoadOrCompile(t, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzReadCompiled sbom.go sbom_test.go
+*/
+func FuzzReadCompiled(f *testing.F) {
+	matchingtest.FuzzCompiled(f, algorithm)
+}
+
+/**
+	Run with: go test -fuzz FuzzBuildOracleMultiple sbom.go sbom_test.go
+	Factor oracle has to recognize every factor of every pattern
+	and each whole pattern has to lead to a state, which is terminal for it.
+*/
+func FuzzBuildOracleMultiple(f *testing.F) {
+	for _, c := range matchingtest.SetCases {
+		f.Add(strings.Join(c.Patterns, " "))
+	}
+	f.Fuzz(func(t *testing.T, patterns string) {
+		if len(patterns) > 100 { //number of factors grows with the square of the length
+			return
+		}
+		p := strings.Split(patterns, " ")
+		or, terminal := buildOracleMultiple(p)
+		for i := range p {
+			for begin := 0; begin < len(p[i]); begin++ {
+				for end := begin + 1; end <= len(p[i]); end++ {
+					state := 0
+					for j := begin; j < end && state != -1; j++ {
+						state = getTransition(state, p[i][j], or)
+					}
+					if state == -1 {
+						t.Errorf("%q: factor %q of %q is not recognized", p, p[i][begin:end], p[i])
+					} else if begin == 0 && end == len(p[i]) && !containsIndex(terminal[state], i) {
+						t.Errorf("%q: pattern %q does not lead to its terminal state", p, p[i])
+					}
+				}
+			}
+		}
+	})
+}
+
+func containsIndex(s []int, e int) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+	Run with: go test -run XXX -bench . sbom.go sbom_test.go
+	Building the oracle and searching for all patterns of each corpus are measured separately.
+*/
+func BenchmarkSbom(b *testing.B) {
+	matchingtest.Benchmark(b, algorithm, ".", func(text string, p []string) func() {
+		lmin := computeMinLength(p)
+		or, f := buildOracleMultiple(reverseAll(trimToLength(p, lmin)))
+		return func() { searchSbom(text, p, lmin, or, f, nil) }
+	})
+}
+
+func TestParallel(t *testing.T) {
+	matchingtest.CheckParallel(t, algorithm)
+}
+
+func TestPatternSet(t *testing.T) {
+	matchingtest.CheckPatternSet(t, newPatternSet)
+}